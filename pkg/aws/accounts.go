@@ -0,0 +1,199 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/dashwave/sharedlib/pkg/vault"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	US_ACCOUNT    = "US-VAULT"
+	INDIA_ACCOUNT = "INDIA-VAULT"
+)
+
+// ErrUnknownAccount is matched by errors.Is when an account name is not
+// registered.
+var ErrUnknownAccount = errors.New("unknown AWS account")
+
+// Account describes where the credentials of a logical AWS account are
+// stored and how to use them.
+type Account struct {
+	// Store is the Vault KV store holding the credentials, it is ignored when
+	// the secret store the account is resolved with is not a
+	// vault.StoreSelector, such as EnvStore.
+	Store string `json:"store" yaml:"store"`
+	// Path of the secret holding AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+	Path string `json:"path" yaml:"path"`
+	// Region used when the caller does not ask for one
+	Region string `json:"region,omitempty" yaml:"region,omitempty"`
+	// RoleARN is assumed with the stored credentials when set
+	RoleARN string `json:"role_arn,omitempty" yaml:"role_arn,omitempty"`
+	// ExternalID is passed when assuming RoleARN
+	ExternalID string `json:"external_id,omitempty" yaml:"external_id,omitempty"`
+	// Endpoint of an S3 compatible store, such as MinIO or R2, instead of AWS
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	// PathStyle addresses buckets as endpoint/bucket, required by most S3
+	// compatible stores
+	PathStyle bool `json:"path_style,omitempty" yaml:"path_style,omitempty"`
+}
+
+// SecretStore returns the store the credentials of the account are read from.
+// Stores holding several KV stores, such as Vault clients and chains of them,
+// are narrowed down to the KV store of the account, any other store is used
+// as is.
+func (a Account) SecretStore(store vault.SecretStore) vault.SecretStore {
+	if selector, ok := store.(vault.StoreSelector); ok && a.Store != "" {
+		return selector.SelectStore(a.Store)
+	}
+	return store
+}
+
+// AccountRegistry maps logical account names, such as US_ACCOUNT, to accounts.
+type AccountRegistry struct {
+	mu       sync.RWMutex
+	accounts map[string]Account
+}
+
+// DefaultAccounts is the registry the connectors resolve account names with.
+// Register more accounts into it, or load them with LoadAccounts or
+// LoadAccountsFromStore.
+//
+// Both default accounts read their credentials from AWS_CREDENTIALS_STORE,
+// as GetAWSSession always did. ConnectAws and ConnectS3 used to read them
+// from the default kv-v2 store instead, and now fail naming both locations
+// when the secrets were not copied over, see LegacyAccounts.
+var DefaultAccounts = NewAccountRegistry(map[string]Account{
+	US_ACCOUNT:    {Store: AWS_CREDENTIALS_STORE, Path: US_VAULT_SECRET_PATH},
+	INDIA_ACCOUNT: {Store: AWS_CREDENTIALS_STORE, Path: INDIA_VAULT_SECRET_PATH},
+})
+
+// LegacyAccounts returns the accounts ConnectAws and ConnectS3 read before
+// accounts were registered: US_VAULT_SECRET_PATH and VAULT_SECRET_PATH in the
+// default kv-v2 store. Services whose credentials were not copied to
+// AWS_CREDENTIALS_STORE yet can keep using them until they are with
+//
+//	sharedAws.DefaultAccounts.RegisterAll(sharedAws.LegacyAccounts())
+//
+// Note this moves GetAWSSession and GetAWSSecretKey to the old secrets too.
+func LegacyAccounts() map[string]Account {
+	return map[string]Account{
+		US_ACCOUNT:    {Store: vault.DEFAULT_KV_STORE, Path: US_VAULT_SECRET_PATH},
+		INDIA_ACCOUNT: {Store: vault.DEFAULT_KV_STORE, Path: VAULT_SECRET_PATH},
+	}
+}
+
+// NewAccountRegistry returns a registry holding accounts, keyed by name.
+func NewAccountRegistry(accounts map[string]Account) *AccountRegistry {
+	r := &AccountRegistry{accounts: make(map[string]Account, len(accounts))}
+	for name, account := range accounts {
+		r.accounts[name] = account
+	}
+	return r
+}
+
+// Register adds account under name, replacing any account of the same name.
+func (r *AccountRegistry) Register(name string, account Account) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.accounts[name] = account
+}
+
+// RegisterAll adds every account of accounts, keyed by name, replacing any
+// account of the same name. Nothing is registered when an account has no
+// secret path.
+func (r *AccountRegistry) RegisterAll(accounts map[string]Account) error {
+	return r.register(accounts)
+}
+
+// Unregister removes the account registered under name, if any.
+func (r *AccountRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.accounts, name)
+}
+
+// Lookup returns the account registered under name.
+func (r *AccountRegistry) Lookup(name string) (Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	account, ok := r.accounts[name]
+	if !ok {
+		return Account{}, fmt.Errorf("%w: %s", ErrUnknownAccount, name)
+	}
+	return account, nil
+}
+
+// Names returns the sorted names of every registered account.
+func (r *AccountRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.accounts))
+	for name := range r.accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadAccounts registers the accounts of a JSON or YAML document mapping
+// account names to accounts, e.g.
+//
+//	EU-VAULT:
+//	  store: aws-credentials
+//	  path: EU-ACCOUNT
+//	  region: eu-west-1
+func (r *AccountRegistry) LoadAccounts(data []byte) error {
+	accounts := map[string]Account{}
+	if err := yaml.Unmarshal(data, &accounts); err != nil {
+		return fmt.Errorf("unable to decode AWS accounts: %v", err)
+	}
+	return r.register(accounts)
+}
+
+// LoadAccountsFromStore registers the accounts of the secret at path, where
+// every key is an account name and every value an account, either as an
+// object or as a JSON string.
+func (r *AccountRegistry) LoadAccountsFromStore(ctx context.Context, store vault.SecretStore, path string) error {
+	secret, err := store.GetMap(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	accounts := make(map[string]Account, len(secret))
+	for name, raw := range secret {
+		data, ok := raw.(string)
+		if !ok {
+			encoded, err := json.Marshal(raw)
+			if err != nil {
+				return fmt.Errorf("unable to decode AWS account %s: %v", name, err)
+			}
+			data = string(encoded)
+		}
+		var account Account
+		if err := json.Unmarshal([]byte(data), &account); err != nil {
+			return fmt.Errorf("unable to decode AWS account %s: %v", name, err)
+		}
+		accounts[name] = account
+	}
+	return r.register(accounts)
+}
+
+func (r *AccountRegistry) register(accounts map[string]Account) error {
+	for name, account := range accounts {
+		if account.Path == "" {
+			return fmt.Errorf("AWS account %s has no secret path", name)
+		}
+	}
+	for name, account := range accounts {
+		r.Register(name, account)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dashwave/sharedlib/pkg/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountRegistry(t *testing.T) {
+	registry := NewAccountRegistry(map[string]Account{US_ACCOUNT: {Store: AWS_CREDENTIALS_STORE, Path: US_VAULT_SECRET_PATH}})
+
+	_, err := registry.Lookup("EU-VAULT")
+	assert.True(t, errors.Is(err, ErrUnknownAccount))
+
+	assert.NoError(t, registry.LoadAccounts([]byte("EU-VAULT:\n  store: aws-credentials\n  path: EU-ACCOUNT\n  region: eu-west-1\n")))
+	account, err := registry.Lookup("EU-VAULT")
+	assert.NoError(t, err)
+	assert.Equal(t, Account{Store: AWS_CREDENTIALS_STORE, Path: "EU-ACCOUNT", Region: "eu-west-1"}, account)
+
+	assert.Error(t, registry.LoadAccounts([]byte(`{"BROKEN": {"store": "aws-credentials"}}`)))
+
+	store := vault.NewMemoryStore(map[string]vault.VaultSecretMap{
+		"AWS-ACCOUNTS": {
+			"SG-VAULT": `{"path": "SG-ACCOUNT", "region": "ap-southeast-1", "role_arn": "arn:aws:iam::1:role/builder"}`,
+			"JP-VAULT": map[string]interface{}{"path": "JP-ACCOUNT"},
+		},
+	})
+	assert.NoError(t, registry.LoadAccountsFromStore(context.Background(), store, "AWS-ACCOUNTS"))
+	account, err = registry.Lookup("SG-VAULT")
+	assert.NoError(t, err)
+	assert.Equal(t, "arn:aws:iam::1:role/builder", account.RoleARN)
+	assert.Equal(t, []string{"EU-VAULT", "JP-VAULT", "SG-VAULT", US_ACCOUNT}, registry.Names())
+}
+
+func TestLegacyAccounts(t *testing.T) {
+	registry := NewAccountRegistry(nil)
+	assert.NoError(t, registry.RegisterAll(LegacyAccounts()))
+
+	account, err := registry.Lookup(INDIA_ACCOUNT)
+	assert.NoError(t, err)
+	assert.Equal(t, Account{Store: vault.DEFAULT_KV_STORE, Path: VAULT_SECRET_PATH}, account)
+	account, err = registry.Lookup(US_ACCOUNT)
+	assert.NoError(t, err)
+	assert.Equal(t, Account{Store: vault.DEFAULT_KV_STORE, Path: US_VAULT_SECRET_PATH}, account)
+
+	registry.Unregister(US_ACCOUNT)
+	_, err = registry.Lookup(US_ACCOUNT)
+	assert.True(t, errors.Is(err, ErrUnknownAccount))
+	assert.Equal(t, []string{INDIA_ACCOUNT}, registry.Names())
+}
@@ -0,0 +1,380 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// MAX_DELETE_BATCH is the most keys S3 deletes in a single request
+	MAX_DELETE_BATCH = 1000
+	// MAX_COPY_OBJECT_SIZE is the largest object copied in a single request,
+	// larger objects are copied in parts
+	MAX_COPY_OBJECT_SIZE = 5 * 1024 * 1024 * 1024
+	// DEFAULT_COPY_PART_SIZE is the part size of multipart copies, raised
+	// by CalculatePartSize for very large objects
+	DEFAULT_COPY_PART_SIZE   = 512 * 1024 * 1024
+	DEFAULT_BULK_CONCURRENCY = 10
+)
+
+// ErrObjectsFailed is matched by errors.Is when a bulk operation failed for
+// some of its keys. The result lists which ones and why.
+var ErrObjectsFailed = errors.New("bulk operation failed for some objects")
+
+// DeleteObject deletes a single object, or a single version of it when
+// VersionId is set. Deleting a missing object is not an error.
+func DeleteObject(ctx context.Context, s3Session *s3.S3, r *DeleteObjectRequest) error {
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(r.BucketName),
+		Key:    aws.String(r.ObjectName),
+	}
+	if r.VersionId != "" {
+		input.VersionId = aws.String(r.VersionId)
+	}
+	_, err := s3Session.DeleteObjectWithContext(ctx, input)
+	return err
+}
+
+// DeleteObjects deletes the given keys in batches of MAX_DELETE_BATCH. Keys
+// that could not be deleted are reported in the result, along with an error
+// matching ErrObjectsFailed.
+func DeleteObjects(ctx context.Context, s3Session *s3.S3, r *DeleteObjectsRequest) (*DeleteResult, error) {
+	result := &DeleteResult{DryRun: r.DryRun}
+	if r.DryRun {
+		result.Deleted = append(result.Deleted, r.Keys...)
+		sort.Strings(result.Deleted)
+		return result, nil
+	}
+
+	var batches [][]string
+	for start := 0; start < len(r.Keys); start += MAX_DELETE_BATCH {
+		end := start + MAX_DELETE_BATCH
+		if end > len(r.Keys) {
+			end = len(r.Keys)
+		}
+		batches = append(batches, r.Keys[start:end])
+	}
+
+	var mu sync.Mutex
+	forEach(len(batches), r.Concurrency, func(i int) {
+		deleted, failed := deleteBatch(ctx, s3Session, r.BucketName, batches[i])
+		mu.Lock()
+		result.Deleted = append(result.Deleted, deleted...)
+		result.Errors = append(result.Errors, failed...)
+		mu.Unlock()
+	})
+
+	sort.Strings(result.Deleted)
+	sort.Slice(result.Errors, func(i, j int) bool { return result.Errors[i].Key < result.Errors[j].Key })
+	return result, bulkError(len(result.Errors), len(r.Keys))
+}
+
+func deleteBatch(ctx context.Context, s3Session *s3.S3, bucket string, keys []string) ([]string, []ObjectError) {
+	objects := make([]*s3.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		objects[i] = &s3.ObjectIdentifier{Key: aws.String(key)}
+	}
+	res, err := s3Session.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		// Quiet responses only list the keys that failed
+		Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+	})
+	if err != nil {
+		failed := make([]ObjectError, len(keys))
+		for i, key := range keys {
+			failed[i] = objectError(key, err)
+		}
+		return nil, failed
+	}
+
+	var failed []ObjectError
+	failedKeys := map[string]bool{}
+	for _, e := range res.Errors {
+		key := aws.StringValue(e.Key)
+		failedKeys[key] = true
+		failed = append(failed, ObjectError{Key: key, Code: aws.StringValue(e.Code), Message: aws.StringValue(e.Message)})
+	}
+	var deleted []string
+	for _, key := range keys {
+		if !failedKeys[key] {
+			deleted = append(deleted, key)
+		}
+	}
+	return deleted, failed
+}
+
+// DeletePrefix deletes every object whose key starts with Prefix. Prefix
+// must not be empty, use DeleteObjects to empty a whole bucket.
+func DeletePrefix(ctx context.Context, s3Session *s3.S3, r *DeletePrefixRequest) (*DeleteResult, error) {
+	if r.Prefix == "" {
+		return nil, fmt.Errorf("prefix must not be empty")
+	}
+	objects, err := ListObjects(ctx, s3Session, &ListObjectsRequest{BucketName: r.BucketName, Prefix: r.Prefix})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list objects under %s: %v", r.Prefix, err)
+	}
+	keys := make([]string, len(objects))
+	for i, object := range objects {
+		keys[i] = object.Key
+	}
+	return DeleteObjects(ctx, s3Session, &DeleteObjectsRequest{
+		BucketName:  r.BucketName,
+		Keys:        keys,
+		Concurrency: r.Concurrency,
+		DryRun:      r.DryRun,
+	})
+}
+
+// CopyObject copies an object within or across buckets, keeping its content
+// type, metadata and other headers such as Cache-Control, its storage class
+// and its encryption. Objects larger than MAX_COPY_OBJECT_SIZE are copied in
+// parts over up to Concurrency concurrent requests.
+func CopyObject(ctx context.Context, s3Session *s3.S3, r *CopyObjectRequest) error {
+	head, err := s3Session.HeadObjectWithContext(ctx, headSourceInput(r))
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", r.SourceKey, err)
+	}
+	return copyObject(ctx, s3Session, r, aws.Int64Value(head.ContentLength), head)
+}
+
+// copyObject copies an object of the given size, so callers that listed
+// the source already do not need to look it up again. head is the source
+// HeadObject result if the caller has one, it is only looked up when nil
+// and the object is copied in parts.
+func copyObject(ctx context.Context, s3Session *s3.S3, r *CopyObjectRequest, size int64, head *s3.HeadObjectOutput) error {
+	if size > MAX_COPY_OBJECT_SIZE {
+		if head == nil {
+			var err error
+			head, err = s3Session.HeadObjectWithContext(ctx, headSourceInput(r))
+			if err != nil {
+				return fmt.Errorf("unable to read %s: %v", r.SourceKey, err)
+			}
+		}
+		return multipartCopy(ctx, s3Session, r, head)
+	}
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(r.BucketName),
+		Key:        aws.String(r.ObjectName),
+		CopySource: aws.String(copySource(r)),
+	}
+	if r.ACL != "" {
+		input.ACL = aws.String(r.ACL)
+	}
+	_, err := s3Session.CopyObjectWithContext(ctx, input)
+	return err
+}
+
+// multipartCopy copies the object described by head in parts.
+func multipartCopy(ctx context.Context, s3Session *s3.S3, r *CopyObjectRequest, head *s3.HeadObjectOutput) error {
+	// Unlike CopyObject, parts do not carry over the source headers, so set
+	// the ones CopyObject would keep on the upload
+	size := aws.Int64Value(head.ContentLength)
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:                  aws.String(r.BucketName),
+		Key:                     aws.String(r.ObjectName),
+		ContentType:             head.ContentType,
+		CacheControl:            head.CacheControl,
+		ContentDisposition:      head.ContentDisposition,
+		ContentEncoding:         head.ContentEncoding,
+		ContentLanguage:         head.ContentLanguage,
+		WebsiteRedirectLocation: head.WebsiteRedirectLocation,
+		Metadata:                head.Metadata,
+		StorageClass:            head.StorageClass,
+		ServerSideEncryption:    head.ServerSideEncryption,
+		SSEKMSKeyId:             head.SSEKMSKeyId,
+		BucketKeyEnabled:        head.BucketKeyEnabled,
+	}
+	if expires, err := http.ParseTime(aws.StringValue(head.Expires)); err == nil {
+		create.Expires = aws.Time(expires)
+	}
+	if r.ACL != "" {
+		create.ACL = aws.String(r.ACL)
+	}
+	upload, err := s3Session.CreateMultipartUploadWithContext(ctx, create)
+	if err != nil {
+		return fmt.Errorf("unable to start multipart copy: %v", err)
+	}
+
+	partSize := CalculatePartSize(size, DEFAULT_COPY_PART_SIZE)
+	parts := make([]*s3.CompletedPart, (size+partSize-1)/partSize)
+
+	// The first failed part cancels the others
+	partCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	var partErr error
+	forEach(len(parts), r.Concurrency, func(i int) {
+		start := int64(i) * partSize
+		end := start + partSize
+		if end > size {
+			end = size
+		}
+		res, err := s3Session.UploadPartCopyWithContext(partCtx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(r.BucketName),
+			Key:             aws.String(r.ObjectName),
+			UploadId:        upload.UploadId,
+			PartNumber:      aws.Int64(int64(i + 1)),
+			CopySource:      aws.String(copySource(r)),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end-1)),
+		})
+		if err != nil {
+			once.Do(func() {
+				partErr = err
+				cancel()
+			})
+			return
+		}
+		parts[i] = &s3.CompletedPart{ETag: res.CopyPartResult.ETag, PartNumber: aws.Int64(int64(i + 1))}
+	})
+
+	if partErr == nil {
+		_, partErr = s3Session.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(r.BucketName),
+			Key:             aws.String(r.ObjectName),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+		if partErr == nil {
+			return nil
+		}
+	}
+	// Parts of an abandoned upload are billed until it is aborted, so abort
+	// even when ctx is already done
+	_, _ = s3Session.AbortMultipartUploadWithContext(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(r.BucketName),
+		Key:      aws.String(r.ObjectName),
+		UploadId: upload.UploadId,
+	})
+	return fmt.Errorf("unable to copy %s in parts: %v", r.SourceKey, partErr)
+}
+
+// MovePrefix moves every object whose key starts with Prefix under
+// DestinationPrefix, in the same or another bucket. Objects are copied
+// first and their sources are only deleted once copied, so a failed move
+// never loses data but may leave both copies behind.
+func MovePrefix(ctx context.Context, s3Session *s3.S3, r *MovePrefixRequest) (*MoveResult, error) {
+	bucket := r.BucketName
+	if bucket == "" {
+		bucket = r.SourceBucket
+	}
+	if bucket == r.SourceBucket && (strings.HasPrefix(r.DestinationPrefix, r.Prefix) || strings.HasPrefix(r.Prefix, r.DestinationPrefix)) {
+		return nil, fmt.Errorf("source prefix %q and destination prefix %q overlap", r.Prefix, r.DestinationPrefix)
+	}
+
+	objects, err := ListObjects(ctx, s3Session, &ListObjectsRequest{BucketName: r.SourceBucket, Prefix: r.Prefix})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list objects under %s: %v", r.Prefix, err)
+	}
+	moves := make([]ObjectMove, len(objects))
+	for i, object := range objects {
+		moves[i] = ObjectMove{Source: object.Key, Destination: r.DestinationPrefix + strings.TrimPrefix(object.Key, r.Prefix)}
+	}
+	result := &MoveResult{DryRun: r.DryRun}
+	if r.DryRun {
+		result.Moved = moves
+		return result, nil
+	}
+
+	copyErrs := make([]error, len(moves))
+	forEach(len(moves), r.Concurrency, func(i int) {
+		copyErrs[i] = copyObject(ctx, s3Session, &CopyObjectRequest{
+			SourceBucket: r.SourceBucket,
+			SourceKey:    moves[i].Source,
+			BucketName:   bucket,
+			ObjectName:   moves[i].Destination,
+		}, objects[i].Size, nil)
+	})
+	var copied []string
+	for i, err := range copyErrs {
+		if err != nil {
+			result.Errors = append(result.Errors, objectError(moves[i].Source, err))
+		} else {
+			copied = append(copied, moves[i].Source)
+		}
+	}
+
+	deleted, _ := DeleteObjects(ctx, s3Session, &DeleteObjectsRequest{
+		BucketName:  r.SourceBucket,
+		Keys:        copied,
+		Concurrency: r.Concurrency,
+	})
+	result.Errors = append(result.Errors, deleted.Errors...)
+	deletedKeys := map[string]bool{}
+	for _, key := range deleted.Deleted {
+		deletedKeys[key] = true
+	}
+	for _, move := range moves {
+		if deletedKeys[move.Source] {
+			result.Moved = append(result.Moved, move)
+		}
+	}
+
+	sort.Slice(result.Errors, func(i, j int) bool { return result.Errors[i].Key < result.Errors[j].Key })
+	return result, bulkError(len(result.Errors), len(moves))
+}
+
+func headSourceInput(r *CopyObjectRequest) *s3.HeadObjectInput {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(r.SourceBucket),
+		Key:    aws.String(r.SourceKey),
+	}
+	if r.SourceVersionId != "" {
+		input.VersionId = aws.String(r.SourceVersionId)
+	}
+	return input
+}
+
+func copySource(r *CopyObjectRequest) string {
+	// S3 decodes the whole source, so escape every reserved character such
+	// as "+" but keep the slashes
+	source := url.QueryEscape(r.SourceBucket + "/" + r.SourceKey)
+	source = strings.NewReplacer("+", "%20", "%2F", "/").Replace(source)
+	if r.SourceVersionId != "" {
+		source += "?versionId=" + url.QueryEscape(r.SourceVersionId)
+	}
+	return source
+}
+
+// forEach calls fn for 0 <= i < n, running up to concurrency calls at a
+// time, and returns once all of them did.
+func forEach(n, concurrency int, fn func(i int)) {
+	if concurrency <= 0 {
+		concurrency = DEFAULT_BULK_CONCURRENCY
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func objectError(key string, err error) ObjectError {
+	if aerr, ok := err.(awserr.Error); ok {
+		return ObjectError{Key: key, Code: aerr.Code(), Message: aerr.Message()}
+	}
+	return ObjectError{Key: key, Message: err.Error()}
+}
+
+func bulkError(failed, total int) error {
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d of %d objects", ErrObjectsFailed, failed, total)
+}
@@ -0,0 +1,330 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteObjects(t *testing.T) {
+	var mu sync.Mutex
+	var batches []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Objects []struct{ Key string } `xml:"Object"`
+		}
+		xml.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		batches = append(batches, len(body.Objects))
+		mu.Unlock()
+
+		w.Write([]byte("<DeleteResult>"))
+		for _, object := range body.Objects {
+			if strings.HasPrefix(object.Key, "locked/") {
+				w.Write([]byte("<Error><Key>" + object.Key + "</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error>"))
+			}
+		}
+		w.Write([]byte("</DeleteResult>"))
+	}))
+	defer server.Close()
+	client := newTestClient(server.URL)
+
+	var keys []string
+	for i := 0; i < 2500; i++ {
+		keys = append(keys, "builds/"+strconv.Itoa(i))
+	}
+	keys = append(keys, "locked/a", "locked/b")
+
+	result, err := DeleteObjects(context.Background(), client, &DeleteObjectsRequest{BucketName: "artefacts", Keys: keys, DryRun: true})
+	assert.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Len(t, result.Deleted, len(keys))
+	assert.Empty(t, batches)
+
+	result, err = DeleteObjects(context.Background(), client, &DeleteObjectsRequest{BucketName: "artefacts", Keys: keys, Concurrency: 2})
+	assert.True(t, errors.Is(err, ErrObjectsFailed))
+	sort.Ints(batches)
+	assert.Equal(t, []int{502, 1000, 1000}, batches)
+	assert.Len(t, result.Deleted, 2500)
+	assert.Equal(t, []ObjectError{
+		{Key: "locked/a", Code: "AccessDenied", Message: "Access Denied"},
+		{Key: "locked/b", Code: "AccessDenied", Message: "Access Denied"},
+	}, result.Errors)
+}
+
+func TestMultipartCopy(t *testing.T) {
+	var mu sync.Mutex
+	var ranges []string
+	var created http.Header
+	var inFlight, maxInFlight int
+	aborted, failPart, heads := false, "", 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("partNumber") != "" {
+			// Hold parts for a while to see how many are copied at a time
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			defer func() {
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+			}()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodHead:
+			heads++
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			created = r.Header.Clone()
+			w.Write([]byte("<InitiateMultipartUploadResult><UploadId>upload</UploadId></InitiateMultipartUploadResult>"))
+		case r.Method == http.MethodPut && query.Get("partNumber") != "":
+			assert.Equal(t, "src-bucket/big.zip", r.Header.Get("X-Amz-Copy-Source"))
+			if query.Get("partNumber") == failPart {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte("<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>"))
+				return
+			}
+			ranges = append(ranges, query.Get("partNumber")+":"+r.Header.Get("X-Amz-Copy-Source-Range"))
+			w.Write([]byte("<CopyPartResult><ETag>\"etag\"</ETag></CopyPartResult>"))
+		case r.Method == http.MethodPost && query.Get("uploadId") != "":
+			w.Write([]byte("<CompleteMultipartUploadResult><Key>big.zip</Key></CompleteMultipartUploadResult>"))
+		case r.Method == http.MethodDelete:
+			aborted = true
+		}
+	}))
+	defer server.Close()
+	client := newTestClient(server.URL)
+
+	req := &CopyObjectRequest{SourceBucket: "src-bucket", SourceKey: "big.zip", BucketName: "dst-bucket", ObjectName: "big.zip"}
+	head := &s3.HeadObjectOutput{
+		ContentLength:        aws.Int64(2*DEFAULT_COPY_PART_SIZE + 100),
+		ContentType:          aws.String("application/zip"),
+		CacheControl:         aws.String("max-age=3600"),
+		ContentDisposition:   aws.String(`attachment; filename="big.zip"`),
+		ContentEncoding:      aws.String("identity"),
+		ContentLanguage:      aws.String("en"),
+		Expires:              aws.String("Wed, 21 Oct 2026 07:28:00 GMT"),
+		Metadata:             aws.StringMap(map[string]string{"Build": "42"}),
+		StorageClass:         aws.String(s3.StorageClassStandardIa),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+		SSEKMSKeyId:          aws.String("alias/artefacts"),
+	}
+	assert.NoError(t, multipartCopy(context.Background(), client, req, head))
+	sort.Strings(ranges)
+	assert.Equal(t, []string{
+		"1:bytes=0-536870911",
+		"2:bytes=536870912-1073741823",
+		"3:bytes=1073741824-1073741923",
+	}, ranges)
+	assert.Equal(t, "application/zip", created.Get("Content-Type"))
+	assert.Equal(t, "max-age=3600", created.Get("Cache-Control"))
+	assert.Equal(t, `attachment; filename="big.zip"`, created.Get("Content-Disposition"))
+	assert.Equal(t, "identity", created.Get("Content-Encoding"))
+	assert.Equal(t, "en", created.Get("Content-Language"))
+	assert.Equal(t, "Wed, 21 Oct 2026 07:28:00 GMT", created.Get("Expires"))
+	assert.Equal(t, "42", created.Get("X-Amz-Meta-Build"))
+	assert.Equal(t, s3.StorageClassStandardIa, created.Get("X-Amz-Storage-Class"))
+	assert.Equal(t, s3.ServerSideEncryptionAwsKms, created.Get("X-Amz-Server-Side-Encryption"))
+	assert.Equal(t, "alias/artefacts", created.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+	assert.False(t, aborted)
+	assert.Zero(t, heads)
+	assert.Equal(t, 3, maxInFlight)
+
+	maxInFlight = 0
+	req.Concurrency = 1
+	assert.NoError(t, multipartCopy(context.Background(), client, req, head))
+	assert.Equal(t, 1, maxInFlight)
+
+	failPart = "2"
+	assert.Error(t, multipartCopy(context.Background(), client, req, head))
+	assert.True(t, aborted)
+}
+
+// fakeBucket serves ListObjectsV2, HeadObject, CopyObject and DeleteObjects
+// over objects keyed by "bucket/key", and logs every copy and deleted key in
+// order.
+type fakeBucket struct {
+	mu       sync.Mutex
+	objects  map[string]int64
+	failCopy string
+	log      []string
+}
+
+func newFakeBucket(t *testing.T, objects map[string]int64) (*fakeBucket, *s3.S3) {
+	fake := &fakeBucket{objects: objects}
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	t.Cleanup(server.Close)
+	return fake, newTestClient(server.URL)
+}
+
+func (f *fakeBucket) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		bucket := strings.TrimSuffix(path, "/")
+		result := listBucketResult{}
+		for name, size := range f.objects {
+			if key := strings.TrimPrefix(name, bucket+"/"); key != name && strings.HasPrefix(key, query.Get("prefix")) {
+				result.Contents = append(result.Contents, fakeObject{Key: key, Size: size})
+			}
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodHead:
+		size, ok := f.objects[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		size, ok := f.objects[source]
+		if !ok || strings.HasSuffix(source, "/"+f.failCopy) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>"))
+			return
+		}
+		f.log = append(f.log, "copy "+source)
+		f.objects[path] = size
+		w.Write([]byte("<CopyObjectResult><ETag>\"etag\"</ETag></CopyObjectResult>"))
+	case r.Method == http.MethodPost && query.Has("delete"):
+		var body struct {
+			Objects []struct{ Key string } `xml:"Object"`
+		}
+		xml.NewDecoder(r.Body).Decode(&body)
+		bucket := strings.TrimSuffix(path, "/")
+		for _, object := range body.Objects {
+			f.log = append(f.log, "delete "+bucket+"/"+object.Key)
+			delete(f.objects, bucket+"/"+object.Key)
+		}
+		w.Write([]byte("<DeleteResult></DeleteResult>"))
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestCopyObject(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	var copySource string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.RawQuery)
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Content-Length", "1024")
+		case http.MethodPut:
+			copySource = r.Header.Get("X-Amz-Copy-Source")
+			w.Write([]byte("<CopyObjectResult><ETag>\"etag\"</ETag></CopyObjectResult>"))
+		}
+	}))
+	defer server.Close()
+
+	versionId := "3/L4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY"
+	assert.NoError(t, CopyObject(context.Background(), newTestClient(server.URL), &CopyObjectRequest{
+		SourceBucket:    "src-bucket",
+		SourceKey:       "reports/build+1 Q1#final.pdf",
+		SourceVersionId: versionId,
+		BucketName:      "dst-bucket",
+		ObjectName:      "reports/q1.pdf",
+	}))
+	// Small objects are copied with a single request, after a single lookup
+	assert.Equal(t, []string{"HEAD versionId=" + url.QueryEscape(versionId), "PUT "}, requests)
+	assert.Equal(t, "src-bucket/reports/build%2B1%20Q1%23final.pdf?versionId=3%2FL4kqtJlcpXroDTDmJ%2BrmSpXd3dIbrHY", copySource)
+}
+
+func TestMovePrefix(t *testing.T) {
+	ctx := context.Background()
+	fake, client := newFakeBucket(t, map[string]int64{
+		"artefacts/builds/1.apk": 10,
+		"artefacts/builds/2.apk": 20,
+		"artefacts/builds/3.apk": 30,
+		"artefacts/keep.apk":     40,
+	})
+
+	_, err := MovePrefix(ctx, client, &MovePrefixRequest{SourceBucket: "artefacts", Prefix: "builds/", DestinationPrefix: "builds/archive/"})
+	assert.Error(t, err)
+	_, err = MovePrefix(ctx, client, &MovePrefixRequest{SourceBucket: "artefacts", Prefix: "builds/archive/", DestinationPrefix: "builds/"})
+	assert.Error(t, err)
+	assert.Empty(t, fake.log)
+
+	result, err := MovePrefix(ctx, client, &MovePrefixRequest{SourceBucket: "artefacts", Prefix: "builds/", DestinationPrefix: "archive/", DryRun: true})
+	assert.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, []ObjectMove{
+		{Source: "builds/1.apk", Destination: "archive/1.apk"},
+		{Source: "builds/2.apk", Destination: "archive/2.apk"},
+		{Source: "builds/3.apk", Destination: "archive/3.apk"},
+	}, result.Moved)
+	assert.Empty(t, fake.log)
+	assert.Len(t, fake.objects, 4)
+
+	// A source is only deleted once copied, so a failed copy keeps it
+	fake.failCopy = "2.apk"
+	result, err = MovePrefix(ctx, client, &MovePrefixRequest{SourceBucket: "artefacts", Prefix: "builds/", DestinationPrefix: "archive/", Concurrency: 2})
+	assert.True(t, errors.Is(err, ErrObjectsFailed))
+	assert.Equal(t, []ObjectMove{
+		{Source: "builds/1.apk", Destination: "archive/1.apk"},
+		{Source: "builds/3.apk", Destination: "archive/3.apk"},
+	}, result.Moved)
+	assert.Equal(t, []ObjectError{{Key: "builds/2.apk", Code: "AccessDenied", Message: "Access Denied"}}, result.Errors)
+	assert.Equal(t, map[string]int64{
+		"artefacts/archive/1.apk": 10,
+		"artefacts/builds/2.apk":  20,
+		"artefacts/archive/3.apk": 30,
+		"artefacts/keep.apk":      40,
+	}, fake.objects)
+	sort.Strings(fake.log[:2])
+	assert.Equal(t, []string{
+		"copy artefacts/builds/1.apk",
+		"copy artefacts/builds/3.apk",
+		"delete artefacts/builds/1.apk",
+		"delete artefacts/builds/3.apk",
+	}, fake.log)
+}
+
+func TestDeletePrefix(t *testing.T) {
+	ctx := context.Background()
+	fake, client := newFakeBucket(t, map[string]int64{
+		"artefacts/tmp/a": 1,
+		"artefacts/tmp/b": 2,
+		"artefacts/tmpl":  3,
+	})
+
+	_, err := DeletePrefix(ctx, client, &DeletePrefixRequest{BucketName: "artefacts"})
+	assert.Error(t, err)
+
+	result, err := DeletePrefix(ctx, client, &DeletePrefixRequest{BucketName: "artefacts", Prefix: "tmp/", DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tmp/a", "tmp/b"}, result.Deleted)
+	assert.Empty(t, fake.log)
+
+	result, err = DeletePrefix(ctx, client, &DeletePrefixRequest{BucketName: "artefacts", Prefix: "tmp/"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tmp/a", "tmp/b"}, result.Deleted)
+	assert.Equal(t, map[string]int64{"artefacts/tmpl": 3}, fake.objects)
+}
@@ -1,7 +1,10 @@
 package s3
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -13,83 +16,146 @@ import (
 )
 
 const (
-	US_VAULT    = "US-VAULT"
-	INDIA_VAULT = "INDIA-VAULT"
+	US_VAULT    = sharedAws.US_ACCOUNT
+	INDIA_VAULT = sharedAws.INDIA_ACCOUNT
 )
 
-func ConnectAws(v *vault.VaultClient, region, accountLocation string) (*session.Session, vault.VaultSecretMap, error) {
-	secretPath := ""
-	if accountLocation == US_VAULT {
-		secretPath = sharedAws.US_VAULT_SECRET_PATH
-	} else if accountLocation == INDIA_VAULT {
-		secretPath = sharedAws.VAULT_SECRET_PATH
-	} else {
-		return nil, nil, fmt.Errorf("invalid AWS account location provided : %s", accountLocation)
+var (
+	// ErrAccountUnknown is matched by errors.Is when the account location is
+	// not registered. It is the same error as sharedAws.ErrUnknownAccount.
+	ErrAccountUnknown = sharedAws.ErrUnknownAccount
+	// ErrSecretMissing is matched by errors.Is when the secret of an account,
+	// or one of its credential keys, does not exist.
+	ErrSecretMissing = errors.New("AWS credentials secret missing")
+	// ErrCredentialMalformed is matched by errors.Is when a credential key is
+	// empty or not a string.
+	ErrCredentialMalformed = errors.New("AWS credential malformed")
+)
+
+// SessionOption customizes the configuration of the sessions created by the
+// connectors, e.g. to target an S3 compatible store such as MinIO or R2.
+type SessionOption func(*aws.Config)
+
+// WithEndpoint sends requests to endpoint instead of AWS, e.g.
+// "http://localhost:9000" for MinIO or
+// "https://<account>.r2.cloudflarestorage.com" for R2.
+func WithEndpoint(endpoint string) SessionOption {
+	return func(c *aws.Config) {
+		c.Endpoint = aws.String(endpoint)
+	}
+}
+
+// WithPathStyle addresses buckets as endpoint/bucket instead of as
+// bucket.endpoint, which most self-hosted stores require.
+func WithPathStyle() SessionOption {
+	return func(c *aws.Config) {
+		c.S3ForcePathStyle = aws.Bool(true)
 	}
-	secrets, err := v.GetSecretMap(secretPath)
+}
+
+// WithDisableSSL uses http for endpoints given without a scheme.
+func WithDisableSSL() SessionOption {
+	return func(c *aws.Config) {
+		c.DisableSSL = aws.Bool(true)
+	}
+}
+
+// WithHTTPClient sends requests with client, e.g. to trust a private CA or
+// route through a proxy. Its Transport must be an *http.Transport when
+// AWS_CA_BUNDLE is set.
+func WithHTTPClient(client *http.Client) SessionOption {
+	return func(c *aws.Config) {
+		c.HTTPClient = client
+	}
+}
+
+func sessionConfig(region string, opts []SessionOption) *aws.Config {
+	config := &aws.Config{Region: aws.String(region)}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+// ConnectAws creates an AWS session for the account registered as
+// accountLocation in sharedAws.DefaultAccounts, with its credentials read
+// from v, which is usually a *vault.VaultClient. The default region and
+// endpoint of the account are used unless overridden by region and opts.
+//
+// US_VAULT and INDIA_VAULT are read from sharedAws.AWS_CREDENTIALS_STORE like
+// GetAWSSession does, where ConnectAws used to read US-ACCOUNT and S3 from
+// the default kv-v2 store. The old secrets are never read in their place:
+// when the new ones are missing or cannot be read, the error names both
+// locations, and matches ErrSecretMissing when they are missing. Register
+// sharedAws.LegacyAccounts to keep reading the old secrets.
+func ConnectAws(v vault.SecretStore, region, accountLocation string, opts ...SessionOption) (*session.Session, vault.VaultSecretMap, error) {
+	account, secrets, err := accountSecrets(v, accountLocation)
+	if err != nil {
+		return nil, nil, err
+	}
+	session, err := accountSession(account, secrets, region, opts)
 	if err != nil {
 		return nil, nil, err
 	}
-	accessKeyID := secrets[sharedAws.AWS_ACCESS_KEY_ID].(string)
-	secretAccessKey := secrets[sharedAws.AWS_SECRET_ACCESS_KEY].(string)
-	myRegion := region
-	newSess, err := session.NewSession(
-		&aws.Config{
-			Region: aws.String(myRegion),
-			Credentials: credentials.NewStaticCredentials(
-				accessKeyID,
-				secretAccessKey,
-				"",
-			),
-		})
-	session := session.Must(newSess, err)
 	return session, secrets, nil
 }
 
-func ConnectS3(region string) (*session.Session, *s3.S3, vault.VaultSecretMap) {
-	vaultClient, err := vault.NewVaultClient()
+// ConnectAwsDefaultChain creates an AWS session for the account registered as
+// accountLocation like ConnectAws, with the credentials of
+// DefaultCredentialChain instead of only the static ones in store: an IRSA
+// web identity, the environment, the shared credentials file and the ECS or
+// EC2 instance role are tried first, and the credentials of the account in
+// store are the last fallback. The role of the account is assumed with
+// whichever credentials are found.
+func ConnectAwsDefaultChain(store vault.SecretStore, region, accountLocation string, opts ...SessionOption) (*session.Session, error) {
+	account, err := sharedAws.DefaultAccounts.Lookup(accountLocation)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("invalid AWS account location provided : %w", err)
 	}
-	awsSession, secrets, err := ConnectAws(vaultClient, region, INDIA_VAULT)
+	return chainSession(account, DefaultCredentialChain(store, accountLocation), region, opts)
+}
+
+// ConnectS3 is like ConnectS3Client but panics on failure.
+//
+// Deprecated: use ConnectS3Client, which returns an error instead.
+func ConnectS3(region string) (*session.Session, *s3.S3, vault.VaultSecretMap) {
+	awsSession, s3Session, secrets, err := ConnectS3Client(region)
 	if err != nil {
 		panic(err)
 	}
-	s3Session := s3.New(awsSession)
 	return awsSession, s3Session, secrets
 }
 
-func GetAWSSession(vaultToken, region, accountLocation string) (*session.Session, error) {
-	vc, err := vault.GetVaultClientByToken(vaultToken)
+// ConnectS3Client creates an S3 client for the India account, with a Vault
+// client created from the environment. See ConnectAws for where the
+// credentials are read from, which moved from S3 in the default kv-v2 store
+// to INDIA-ACCOUNT in sharedAws.AWS_CREDENTIALS_STORE.
+func ConnectS3Client(region string, opts ...SessionOption) (*session.Session, *s3.S3, vault.VaultSecretMap, error) {
+	vaultClient, err := vault.NewVaultClient()
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
-
-	secretPath := ""
-	if accountLocation == US_VAULT {
-		secretPath = sharedAws.US_VAULT_SECRET_PATH
-	} else if accountLocation == INDIA_VAULT {
-		secretPath = sharedAws.INDIA_VAULT_SECRET_PATH
-	} else {
-		return nil, fmt.Errorf("invalid AWS account location provided : %s", accountLocation)
+	awsSession, secrets, err := ConnectAws(vaultClient, region, INDIA_VAULT, opts...)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	secrets, err := vc.GetSecretMapByStore(secretPath, sharedAws.AWS_CREDENTIALS_STORE)
+	s3Session := s3.New(awsSession)
+	return awsSession, s3Session, secrets, nil
+}
+
+func GetAWSSession(vaultToken, region, accountLocation string, opts ...SessionOption) (*session.Session, error) {
+	vc, err := vault.GetVaultClientByToken(vaultToken)
 	if err != nil {
 		return nil, err
 	}
-	accessKeyID := secrets[sharedAws.AWS_ACCESS_KEY_ID].(string)
-	secretAccessKey := secrets[sharedAws.AWS_SECRET_ACCESS_KEY].(string)
-	newSess, err := session.NewSession(
-		&aws.Config{
-			Region: aws.String(region),
-			Credentials: credentials.NewStaticCredentials(
-				accessKeyID,
-				secretAccessKey,
-				"",
-			),
-		})
-	session := session.Must(newSess, err)
-	return session, nil
+	return GetAWSSessionFromStore(vc, region, accountLocation, opts...)
+}
+
+// GetAWSSessionFromStore creates an AWS session for accountLocation like
+// ConnectAws, without returning the secrets.
+func GetAWSSessionFromStore(store vault.SecretStore, region, accountLocation string, opts ...SessionOption) (*session.Session, error) {
+	session, _, err := ConnectAws(store, region, accountLocation, opts...)
+	return session, err
 }
 
 func GetAWSSecretKey(vaultToken, accountLocation string) (string, string, error) {
@@ -97,26 +163,110 @@ func GetAWSSecretKey(vaultToken, accountLocation string) (string, string, error)
 	if err != nil {
 		return "", "", err
 	}
+	return GetAWSSecretKeyFromStore(vc, accountLocation)
+}
+
+// GetAWSSecretKeyFromStore returns the access key id and secret access key of
+// accountLocation read from store.
+func GetAWSSecretKeyFromStore(store vault.SecretStore, accountLocation string) (string, string, error) {
+	_, secrets, err := accountSecrets(store, accountLocation)
+	if err != nil {
+		return "", "", err
+	}
+	return accessKeys(secrets)
+}
+
+// accountSecrets resolves accountLocation and reads the secret holding its
+// credentials.
+func accountSecrets(store vault.SecretStore, accountLocation string) (sharedAws.Account, vault.VaultSecretMap, error) {
+	account, err := sharedAws.DefaultAccounts.Lookup(accountLocation)
+	if err != nil {
+		return account, nil, fmt.Errorf("invalid AWS account location provided : %w", err)
+	}
+	secrets, err := account.SecretStore(store).GetMap(context.Background(), account.Path)
+	if err != nil {
+		return account, nil, accountSecretError(store, accountLocation, account, err)
+	}
+	return account, secrets, nil
+}
 
-	secretPath := ""
-	if accountLocation == US_VAULT {
-		secretPath = sharedAws.US_VAULT_SECRET_PATH
-	} else if accountLocation == INDIA_VAULT {
-		secretPath = sharedAws.INDIA_VAULT_SECRET_PATH
-	} else {
-		return "", "", fmt.Errorf("invalid AWS account location provided : %s", accountLocation)
+// accountSecretError describes why the secret of an account could not be
+// read. The default accounts moved from the default kv-v2 store to
+// sharedAws.AWS_CREDENTIALS_STORE, so for them the old location is named
+// too, rather than quietly falling back to it.
+func accountSecretError(store vault.SecretStore, accountLocation string, account sharedAws.Account, err error) error {
+	location, moved := account.Path, ""
+	if _, ok := store.(vault.StoreSelector); ok && account.Store != "" {
+		location += " in " + account.Store
+		if legacy, ok := sharedAws.LegacyAccounts()[accountLocation]; ok && legacy != account {
+			moved = fmt.Sprintf(" (ConnectAws and ConnectS3 used to read %s in %s, copy it over or register sharedAws.LegacyAccounts)", legacy.Path, legacy.Store)
+		}
+	}
+	if errors.Is(err, vault.ErrSecretNotFound) {
+		return fmt.Errorf("%w: %s for account %s%s", ErrSecretMissing, location, accountLocation, moved)
 	}
-	secrets, err := vc.GetSecretMapByStore(secretPath, sharedAws.AWS_CREDENTIALS_STORE)
+	if moved != "" {
+		return fmt.Errorf("unable to read %s for account %s%s: %w", location, accountLocation, moved, err)
+	}
+	return err
+}
+
+func accessKeys(secrets vault.VaultSecretMap) (string, string, error) {
+	accessKeyID, err := credential(secrets, sharedAws.AWS_ACCESS_KEY_ID)
 	if err != nil {
 		return "", "", err
 	}
-	accessKeyID, ok := secrets[sharedAws.AWS_ACCESS_KEY_ID]
-	if !ok {
-		return "", "", fmt.Errorf("access key id not found in vault")
+	secretAccessKey, err := credential(secrets, sharedAws.AWS_SECRET_ACCESS_KEY)
+	if err != nil {
+		return "", "", err
 	}
-	secretAccessKey, ok := secrets[sharedAws.AWS_SECRET_ACCESS_KEY]
+	return accessKeyID, secretAccessKey, nil
+}
+
+func credential(secrets vault.VaultSecretMap, key string) (string, error) {
+	raw, ok := secrets[key]
 	if !ok {
-		return "", "", fmt.Errorf("secret access key not found in vault")
+		return "", fmt.Errorf("%w: %s not found in vault", ErrSecretMissing, key)
+	}
+	value, ok := raw.(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("%w: %s is not a non-empty string", ErrCredentialMalformed, key)
+	}
+	return value, nil
+}
+
+// accountSession creates a session with the credentials in secrets, assuming
+// the role of the account when it has one.
+func accountSession(account sharedAws.Account, secrets vault.VaultSecretMap, region string, opts []SessionOption) (*session.Session, error) {
+	accessKeyID, secretAccessKey, err := accessKeys(secrets)
+	if err != nil {
+		return nil, err
+	}
+	chain := NewCredentialChain().WithProvider(&credentials.StaticProvider{Value: credentials.Value{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+	}})
+	return chainSession(account, chain, region, opts)
+}
+
+// chainSession creates a session with the credentials of chain, in the
+// default region and endpoint of the account unless overridden, assuming the
+// role of the account when it has one.
+func chainSession(account sharedAws.Account, chain *CredentialChain, region string, opts []SessionOption) (*session.Session, error) {
+	if region == "" {
+		region = account.Region
+	}
+
+	var accountOpts []SessionOption
+	if account.Endpoint != "" {
+		accountOpts = append(accountOpts, WithEndpoint(account.Endpoint))
+	}
+	if account.PathStyle {
+		accountOpts = append(accountOpts, WithPathStyle())
+	}
+
+	if account.RoleARN != "" {
+		chain.AssumeRole(AssumeRoleRequest{RoleARN: account.RoleARN, ExternalID: account.ExternalID})
 	}
-	return accessKeyID.(string), secretAccessKey.(string), nil
+	return chain.Session(region, append(accountOpts, opts...)...)
 }
@@ -0,0 +1,181 @@
+package s3
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	sharedAws "github.com/dashwave/sharedlib/pkg/aws"
+	"github.com/dashwave/sharedlib/pkg/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAWSSecretKeyFromStore(t *testing.T) {
+	store := vault.NewMemoryStore(map[string]vault.VaultSecretMap{
+		sharedAws.US_VAULT_SECRET_PATH: {
+			sharedAws.AWS_ACCESS_KEY_ID:     "AKIA",
+			sharedAws.AWS_SECRET_ACCESS_KEY: "secret",
+		},
+	})
+
+	accessKeyID, secretAccessKey, err := GetAWSSecretKeyFromStore(store, US_VAULT)
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIA", accessKeyID)
+	assert.Equal(t, "secret", secretAccessKey)
+
+	_, _, err = GetAWSSecretKeyFromStore(store, INDIA_VAULT)
+	assert.True(t, errors.Is(err, ErrSecretMissing))
+	_, _, err = GetAWSSecretKeyFromStore(store, "MARS-VAULT")
+	assert.True(t, errors.Is(err, ErrAccountUnknown))
+}
+
+func TestConnectAwsMalformedCredentials(t *testing.T) {
+	store := vault.NewMemoryStore(map[string]vault.VaultSecretMap{
+		sharedAws.US_VAULT_SECRET_PATH:    {sharedAws.AWS_ACCESS_KEY_ID: "AKIA"},
+		sharedAws.INDIA_VAULT_SECRET_PATH: {sharedAws.AWS_ACCESS_KEY_ID: 42, sharedAws.AWS_SECRET_ACCESS_KEY: "secret"},
+	})
+
+	_, _, err := ConnectAws(store, "us-east-1", US_VAULT)
+	assert.True(t, errors.Is(err, ErrSecretMissing))
+	_, _, err = ConnectAws(store, "ap-south-1", INDIA_VAULT)
+	assert.True(t, errors.Is(err, ErrCredentialMalformed))
+}
+
+func TestConnectAwsRegisteredAccount(t *testing.T) {
+	sharedAws.DefaultAccounts.Register("EU-VAULT", sharedAws.Account{Path: "EU-ACCOUNT", Region: "eu-west-1"})
+	t.Cleanup(func() { sharedAws.DefaultAccounts.Unregister("EU-VAULT") })
+	store := vault.NewMemoryStore(map[string]vault.VaultSecretMap{
+		"EU-ACCOUNT": {
+			sharedAws.AWS_ACCESS_KEY_ID:     "AKIA",
+			sharedAws.AWS_SECRET_ACCESS_KEY: "secret",
+		},
+	})
+
+	sess, secrets, err := ConnectAws(store, "", "EU-VAULT")
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", *sess.Config.Region)
+	assert.Equal(t, "AKIA", secrets[sharedAws.AWS_ACCESS_KEY_ID])
+
+	sess, _, err = ConnectAws(store, "eu-central-1", "EU-VAULT", WithEndpoint("localhost:9000"), WithPathStyle(), WithDisableSSL())
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-central-1", *sess.Config.Region)
+	assert.Equal(t, "localhost:9000", *sess.Config.Endpoint)
+	assert.True(t, *sess.Config.S3ForcePathStyle)
+	assert.True(t, *sess.Config.DisableSSL)
+}
+
+func TestConnectAwsMovedCredentials(t *testing.T) {
+	credentials := map[string]interface{}{"data": map[string]interface{}{"data": map[string]interface{}{
+		sharedAws.AWS_ACCESS_KEY_ID:     "AKIA",
+		sharedAws.AWS_SECRET_ACCESS_KEY: "secret",
+	}}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		// Only the old India secret and the new US secret exist, and the
+		// new India secret is not readable
+		case "/v1/" + vault.DEFAULT_KV_STORE + "/data/" + sharedAws.VAULT_SECRET_PATH,
+			"/v1/" + sharedAws.AWS_CREDENTIALS_STORE + "/data/" + sharedAws.US_VAULT_SECRET_PATH:
+			json.NewEncoder(w).Encode(credentials)
+		case "/v1/" + sharedAws.AWS_CREDENTIALS_STORE + "/data/" + sharedAws.INDIA_VAULT_SECRET_PATH:
+			if r.Header.Get("X-Vault-Token") == "restricted" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	vc, err := vault.New(vault.WithAddress(server.URL), vault.WithToken("token"), vault.WithRetry(0, 0, 0))
+	assert.NoError(t, err)
+
+	// The old secret is named, not read
+	_, _, err = ConnectAws(vc, "ap-south-1", INDIA_VAULT)
+	assert.True(t, errors.Is(err, ErrSecretMissing))
+	assert.Contains(t, err.Error(), sharedAws.INDIA_VAULT_SECRET_PATH+" in "+sharedAws.AWS_CREDENTIALS_STORE)
+	assert.Contains(t, err.Error(), sharedAws.VAULT_SECRET_PATH+" in "+vault.DEFAULT_KV_STORE)
+
+	restricted, err := vault.New(vault.WithAddress(server.URL), vault.WithToken("restricted"), vault.WithRetry(0, 0, 0))
+	assert.NoError(t, err)
+	_, _, err = ConnectAws(restricted, "ap-south-1", INDIA_VAULT)
+	assert.False(t, errors.Is(err, ErrSecretMissing))
+	assert.Contains(t, err.Error(), sharedAws.VAULT_SECRET_PATH+" in "+vault.DEFAULT_KV_STORE)
+
+	// The account store is selected through wrapping stores too
+	_, secrets, err := ConnectAws(vault.NewChainStore(vault.NewMemoryStore(nil), vc), "us-east-1", US_VAULT)
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIA", secrets[sharedAws.AWS_ACCESS_KEY_ID])
+
+	india, err := sharedAws.DefaultAccounts.Lookup(INDIA_VAULT)
+	assert.NoError(t, err)
+	sharedAws.DefaultAccounts.Register(INDIA_VAULT, sharedAws.LegacyAccounts()[INDIA_VAULT])
+	t.Cleanup(func() { sharedAws.DefaultAccounts.Register(INDIA_VAULT, india) })
+	_, secrets, err = ConnectAws(vc, "ap-south-1", INDIA_VAULT)
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIA", secrets[sharedAws.AWS_ACCESS_KEY_ID])
+}
+
+// countingTransport counts the requests sent through it.
+type countingTransport struct {
+	requests int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.requests, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestConnectAwsHTTPClient(t *testing.T) {
+	// The SDK can only add a CA bundle to an *http.Transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	store := vault.NewMemoryStore(map[string]vault.VaultSecretMap{
+		sharedAws.US_VAULT_SECRET_PATH: {sharedAws.AWS_ACCESS_KEY_ID: "AKIA", sharedAws.AWS_SECRET_ACCESS_KEY: "secret"},
+	})
+
+	transport := &countingTransport{}
+	sess, err := GetAWSSessionFromStore(store, "us-east-1", US_VAULT, WithEndpoint(server.URL), WithPathStyle(), WithHTTPClient(&http.Client{Transport: transport}))
+	assert.NoError(t, err)
+	exists, err := DoesObjectExists(s3.New(sess), &ObjectExistsReq{BucketName: "artefacts", ObjectName: "app.apk"})
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&transport.requests))
+}
+
+func TestGetAWSSessionByToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "runner-token" || r.URL.Path != "/v1/"+sharedAws.AWS_CREDENTIALS_STORE+"/data/"+sharedAws.INDIA_VAULT_SECRET_PATH {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": map[string]interface{}{
+			sharedAws.AWS_ACCESS_KEY_ID:     "AKIA-india",
+			sharedAws.AWS_SECRET_ACCESS_KEY: "secret",
+		}}})
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_MAX_RETRIES", "0")
+
+	sess, err := GetAWSSession("runner-token", "ap-south-1", INDIA_VAULT)
+	assert.NoError(t, err)
+	value, err := sess.Config.Credentials.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIA-india", value.AccessKeyID)
+
+	accessKeyID, secretAccessKey, err := GetAWSSecretKey("runner-token", INDIA_VAULT)
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIA-india", accessKeyID)
+	assert.Equal(t, "secret", secretAccessKey)
+
+	_, err = GetAWSSession("wrong-token", "ap-south-1", INDIA_VAULT)
+	assert.Error(t, err)
+}
@@ -0,0 +1,216 @@
+package s3
+
+import (
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/dashwave/sharedlib/pkg/vault"
+)
+
+const (
+	VAULT_STATIC_PROVIDER_NAME = "VaultStaticCredentials"
+	DEFAULT_ROLE_SESSION_NAME  = "sharedlib"
+)
+
+// AssumeRoleRequest describes a role to assume with STS AssumeRole.
+type AssumeRoleRequest struct {
+	RoleARN string
+	// ExternalID required by the trust policy of cross-account roles
+	ExternalID string
+	// SessionName defaults to DEFAULT_ROLE_SESSION_NAME
+	SessionName string
+	// Duration of the role session, the STS default of one hour when zero
+	Duration time.Duration
+	// Tags are passed as session tags, and TransitiveTagKeys lists the ones
+	// carried over to roles assumed further down the chain
+	Tags              map[string]string
+	TransitiveTagKeys []string
+}
+
+// CredentialChain builds AWS credentials from a list of sources tried in
+// order, and then assumes a chain of roles with the first credentials found.
+// Build one with NewCredentialChain or DefaultCredentialChain.
+type CredentialChain struct {
+	config    *aws.Config
+	providers []func(*session.Session) credentials.Provider
+	roles     []AssumeRoleRequest
+}
+
+// NewCredentialChain returns an empty chain. Add sources with the With
+// methods, they are tried in the order they are added.
+func NewCredentialChain() *CredentialChain {
+	return &CredentialChain{config: &aws.Config{}}
+}
+
+// DefaultCredentialChain returns a chain trying web identity (IRSA), the
+// environment, the shared credentials file, ECS or EC2 instance metadata
+// and finally the static credentials of accountLocation in store.
+func DefaultCredentialChain(store vault.SecretStore, accountLocation string) *CredentialChain {
+	return NewCredentialChain().
+		WithWebIdentity("", "", "").
+		WithEnv().
+		WithSharedCredentials("", "").
+		WithInstanceMetadata().
+		WithVault(store, accountLocation)
+}
+
+// WithConfig merges config, e.g. a custom STS endpoint, into the sessions
+// the chain uses to fetch credentials.
+func (c *CredentialChain) WithConfig(config *aws.Config) *CredentialChain {
+	c.config.MergeIn(config)
+	return c
+}
+
+// WithProvider adds a custom source.
+func (c *CredentialChain) WithProvider(provider credentials.Provider) *CredentialChain {
+	c.providers = append(c.providers, func(*session.Session) credentials.Provider { return provider })
+	return c
+}
+
+// WithWebIdentity adds credentials for roleARN obtained with the OIDC token
+// in tokenFile, as mounted by EKS for IAM roles for service accounts. Empty
+// values are read from AWS_ROLE_ARN, AWS_WEB_IDENTITY_TOKEN_FILE and
+// AWS_ROLE_SESSION_NAME, and the source is skipped when there is no role or
+// token file.
+func (c *CredentialChain) WithWebIdentity(roleARN, tokenFile, sessionName string) *CredentialChain {
+	roleARN = valueOrEnv(roleARN, "AWS_ROLE_ARN")
+	tokenFile = valueOrEnv(tokenFile, "AWS_WEB_IDENTITY_TOKEN_FILE")
+	sessionName = valueOrEnv(sessionName, "AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = DEFAULT_ROLE_SESSION_NAME
+	}
+	if roleARN == "" || tokenFile == "" {
+		return c
+	}
+	c.providers = append(c.providers, func(sess *session.Session) credentials.Provider {
+		return stscreds.NewWebIdentityRoleProviderWithOptions(sts.New(sess), roleARN, sessionName, stscreds.FetchTokenPath(tokenFile))
+	})
+	return c
+}
+
+// WithEnv adds the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY variables.
+func (c *CredentialChain) WithEnv() *CredentialChain {
+	return c.WithProvider(&credentials.EnvProvider{})
+}
+
+// WithSharedCredentials adds a profile of the shared credentials file, both
+// default to the standard AWS locations when empty.
+func (c *CredentialChain) WithSharedCredentials(filename, profile string) *CredentialChain {
+	return c.WithProvider(&credentials.SharedCredentialsProvider{Filename: filename, Profile: profile})
+}
+
+// WithInstanceMetadata adds the ECS task role, or the EC2 instance profile.
+func (c *CredentialChain) WithInstanceMetadata() *CredentialChain {
+	c.providers = append(c.providers, func(sess *session.Session) credentials.Provider {
+		return defaults.RemoteCredProvider(*sess.Config, sess.Handlers)
+	})
+	return c
+}
+
+// WithVault adds the static credentials of accountLocation read from store,
+// resolved like ConnectAws does.
+func (c *CredentialChain) WithVault(store vault.SecretStore, accountLocation string) *CredentialChain {
+	return c.WithProvider(&vaultStaticProvider{store: store, accountLocation: accountLocation})
+}
+
+// AssumeRole adds a role to assume once credentials are found. Roles are
+// assumed in the order they are added, each with the credentials of the
+// previous one, to reach roles that are only trusted by another role.
+func (c *CredentialChain) AssumeRole(req AssumeRoleRequest) *CredentialChain {
+	c.roles = append(c.roles, req)
+	return c
+}
+
+// Credentials returns the credentials of the chain. Sources are only queried
+// when the credentials are first used.
+func (c *CredentialChain) Credentials(region string) (*credentials.Credentials, error) {
+	// Sources fetch their credentials without signing, so an anonymous
+	// session is enough for them
+	base, err := session.NewSession(c.config.Copy(&aws.Config{Region: aws.String(region), Credentials: credentials.AnonymousCredentials}))
+	if err != nil {
+		return nil, err
+	}
+
+	providers := make([]credentials.Provider, 0, len(c.providers))
+	for _, provider := range c.providers {
+		providers = append(providers, provider(base))
+	}
+	creds := credentials.NewCredentials(&credentials.ChainProvider{Providers: providers, VerboseErrors: true})
+
+	for _, role := range c.roles {
+		sess := base.Copy(&aws.Config{Credentials: creds})
+		creds = stscreds.NewCredentials(sess, role.RoleARN, role.apply)
+	}
+	return creds, nil
+}
+
+// Session returns a session in region authenticated with the credentials of
+// the chain. opts only apply to the returned session, use WithConfig to
+// change how credentials are fetched.
+func (c *CredentialChain) Session(region string, opts ...SessionOption) (*session.Session, error) {
+	creds, err := c.Credentials(region)
+	if err != nil {
+		return nil, err
+	}
+	config := sessionConfig(region, opts)
+	config.Credentials = creds
+	return session.NewSession(config)
+}
+
+func (r AssumeRoleRequest) apply(p *stscreds.AssumeRoleProvider) {
+	p.RoleSessionName = r.SessionName
+	if p.RoleSessionName == "" {
+		p.RoleSessionName = DEFAULT_ROLE_SESSION_NAME
+	}
+	if r.ExternalID != "" {
+		p.ExternalID = aws.String(r.ExternalID)
+	}
+	if r.Duration > 0 {
+		p.Duration = r.Duration
+	}
+	for key, value := range r.Tags {
+		p.Tags = append(p.Tags, &sts.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	p.TransitiveTagKeys = aws.StringSlice(r.TransitiveTagKeys)
+}
+
+// vaultStaticProvider reads the static credentials of an account once.
+type vaultStaticProvider struct {
+	store           vault.SecretStore
+	accountLocation string
+	retrieved       bool
+}
+
+func (p *vaultStaticProvider) Retrieve() (credentials.Value, error) {
+	_, secrets, err := accountSecrets(p.store, p.accountLocation)
+	if err != nil {
+		return credentials.Value{ProviderName: VAULT_STATIC_PROVIDER_NAME}, err
+	}
+	accessKeyID, secretAccessKey, err := accessKeys(secrets)
+	if err != nil {
+		return credentials.Value{ProviderName: VAULT_STATIC_PROVIDER_NAME}, err
+	}
+	p.retrieved = true
+	return credentials.Value{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		ProviderName:    VAULT_STATIC_PROVIDER_NAME,
+	}, nil
+}
+
+func (p *vaultStaticProvider) IsExpired() bool {
+	return !p.retrieved
+}
+
+func valueOrEnv(value, env string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(env)
+}
@@ -0,0 +1,153 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	sharedAws "github.com/dashwave/sharedlib/pkg/aws"
+	"github.com/dashwave/sharedlib/pkg/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSTS answers AssumeRole and AssumeRoleWithWebIdentity, issuing access
+// keys named after the role, and records who signed each request.
+type fakeSTS struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (f *fakeSTS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	action := r.Form.Get("Action")
+	role := r.Form.Get("RoleArn")
+	signer := "anonymous"
+	if auth := r.Header.Get("Authorization"); strings.Contains(auth, "Credential=") {
+		signer = strings.SplitN(strings.SplitN(auth, "Credential=", 2)[1], "/", 2)[0]
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, fmt.Sprintf("%s %s by %s external=%s tags=%s", action, role, signer, r.Form.Get("ExternalId"), r.Form.Get("Tags.member.1.Key")))
+	f.mu.Unlock()
+
+	key := "ASIA-" + role[strings.LastIndex(role, "/")+1:]
+	fmt.Fprintf(w, `<%[1]sResponse><%[1]sResult><Credentials>
+<AccessKeyId>%[2]s</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>
+<Expiration>2099-01-01T00:00:00Z</Expiration></Credentials></%[1]sResult></%[1]sResponse>`, action, key)
+}
+
+func newFakeSTS(t *testing.T) (*fakeSTS, *aws.Config) {
+	f := &fakeSTS{}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, &aws.Config{Endpoint: aws.String(server.URL)}
+}
+
+func TestCredentialChainAssumeRole(t *testing.T) {
+	sts, config := newFakeSTS(t)
+
+	creds, err := NewCredentialChain().
+		WithConfig(config).
+		WithProvider(&credentials.StaticProvider{Value: credentials.Value{AccessKeyID: "AKIA-base", SecretAccessKey: "secret"}}).
+		AssumeRole(AssumeRoleRequest{RoleARN: "arn:aws:iam::1:role/hub", ExternalID: "ext", Tags: map[string]string{"team": "build"}}).
+		AssumeRole(AssumeRoleRequest{RoleARN: "arn:aws:iam::2:role/target"}).
+		Credentials("us-east-1")
+	assert.NoError(t, err)
+
+	value, err := creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "ASIA-target", value.AccessKeyID)
+	assert.Equal(t, []string{
+		"AssumeRole arn:aws:iam::1:role/hub by AKIA-base external=ext tags=team",
+		"AssumeRole arn:aws:iam::2:role/target by ASIA-hub external= tags=",
+	}, sts.requests)
+}
+
+func TestCredentialChainFallback(t *testing.T) {
+	sts, config := newFakeSTS(t)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("oidc-token"), 0600))
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	store := vault.NewMemoryStore(map[string]vault.VaultSecretMap{
+		sharedAws.US_VAULT_SECRET_PATH: {sharedAws.AWS_ACCESS_KEY_ID: "AKIA-vault", sharedAws.AWS_SECRET_ACCESS_KEY: "secret"},
+	})
+
+	// Without a web identity or environment credentials Vault is used
+	creds, err := NewCredentialChain().WithConfig(config).WithWebIdentity("", "", "").WithEnv().WithVault(store, US_VAULT).Credentials("us-east-1")
+	assert.NoError(t, err)
+	value, err := creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIA-vault", value.AccessKeyID)
+	assert.Equal(t, VAULT_STATIC_PROVIDER_NAME, value.ProviderName)
+
+	// On EKS the web identity token comes first
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::1:role/irsa")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	creds, err = NewCredentialChain().WithConfig(config).WithWebIdentity("", "", "").WithEnv().WithVault(store, US_VAULT).Credentials("us-east-1")
+	assert.NoError(t, err)
+	value, err = creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "ASIA-irsa", value.AccessKeyID)
+	assert.Equal(t, "AssumeRoleWithWebIdentity arn:aws:iam::1:role/irsa by anonymous external= tags=", sts.requests[0])
+}
+
+func TestConnectAwsDefaultChain(t *testing.T) {
+	_, config := newFakeSTS(t)
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("oidc-token"), 0600))
+	sharedFile := filepath.Join(dir, "credentials")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", sharedFile)
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_ROLE_ARN", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	store := vault.NewMemoryStore(map[string]vault.VaultSecretMap{
+		sharedAws.US_VAULT_SECRET_PATH: {sharedAws.AWS_ACCESS_KEY_ID: "AKIA-vault", sharedAws.AWS_SECRET_ACCESS_KEY: "secret"},
+	})
+	accessKeyID := func() string {
+		creds, err := DefaultCredentialChain(store, US_VAULT).WithConfig(config).Credentials("us-east-1")
+		assert.NoError(t, err)
+		value, err := creds.Get()
+		assert.NoError(t, err)
+		return value.AccessKeyID
+	}
+
+	sess, err := ConnectAwsDefaultChain(store, "", US_VAULT)
+	assert.NoError(t, err)
+	value, err := sess.Config.Credentials.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIA-vault", value.AccessKeyID)
+	_, err = ConnectAwsDefaultChain(store, "", "MARS-VAULT")
+	assert.True(t, errors.Is(err, ErrAccountUnknown))
+
+	// Every source of the runtime is added in turn, each one taking
+	// precedence over the previous ones, Vault being the last fallback
+	assert.Equal(t, "AKIA-vault", accessKeyID())
+
+	assert.NoError(t, os.WriteFile(sharedFile, []byte("[default]\naws_access_key_id = AKIA-shared\naws_secret_access_key = secret\n"), 0600))
+	assert.Equal(t, "AKIA-shared", accessKeyID())
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIA-env")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	assert.Equal(t, "AKIA-env", accessKeyID())
+
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::1:role/irsa")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	assert.Equal(t, "ASIA-irsa", accessKeyID())
+}
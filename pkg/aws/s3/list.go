@@ -0,0 +1,154 @@
+package s3
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectIterator walks every page of a listing. Use it as
+//
+//	it := NewObjectIterator(ctx, s3Session, req)
+//	for it.Next() {
+//		object := it.Object()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type ObjectIterator struct {
+	ctx       context.Context
+	s3Session *s3.S3
+	req       *ListObjectsRequest
+
+	page     []ObjectInfo
+	current  ObjectInfo
+	token    *string
+	started  bool
+	finished bool
+	err      error
+}
+
+// NewObjectIterator returns an iterator over the objects matching r. No
+// request is made until Next is called.
+func NewObjectIterator(ctx context.Context, s3Session *s3.S3, r *ListObjectsRequest) *ObjectIterator {
+	it := &ObjectIterator{ctx: ctx, s3Session: s3Session, req: r}
+	if r.Pattern != "" {
+		// Report malformed patterns upfront instead of matching nothing
+		if _, err := path.Match(r.Pattern, ""); err != nil {
+			it.err = err
+		}
+	}
+	return it
+}
+
+// Next advances to the next matching object or common prefix, fetching the
+// next page when needed. It returns false once the listing is exhausted or
+// a request failed.
+func (it *ObjectIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.finished {
+			return false
+		}
+		it.fetch()
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Object returns the object or common prefix Next advanced to.
+func (it *ObjectIterator) Object() ObjectInfo {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ObjectIterator) Err() error {
+	return it.err
+}
+
+func (it *ObjectIterator) fetch() {
+	input := &s3.ListObjectsV2Input{
+		Bucket:            aws.String(it.req.BucketName),
+		ContinuationToken: it.token,
+	}
+	if it.req.Prefix != "" {
+		input.Prefix = aws.String(it.req.Prefix)
+	}
+	if it.req.Delimiter != "" {
+		input.Delimiter = aws.String(it.req.Delimiter)
+	}
+	if it.req.StartAfter != "" && !it.started {
+		input.StartAfter = aws.String(it.req.StartAfter)
+	}
+	if it.req.PageSize > 0 {
+		input.MaxKeys = aws.Int64(it.req.PageSize)
+	}
+
+	res, err := it.s3Session.ListObjectsV2WithContext(it.ctx, input)
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.started = true
+	it.token = res.NextContinuationToken
+	it.finished = !aws.BoolValue(res.IsTruncated) || it.token == nil
+
+	for _, prefix := range res.CommonPrefixes {
+		info := ObjectInfo{Key: aws.StringValue(prefix.Prefix), IsPrefix: true}
+		if it.req.matches(info) {
+			it.page = append(it.page, info)
+		}
+	}
+	for _, object := range res.Contents {
+		info := ObjectInfo{
+			Key:          aws.StringValue(object.Key),
+			Size:         aws.Int64Value(object.Size),
+			LastModified: aws.TimeValue(object.LastModified),
+			ETag:         aws.StringValue(object.ETag),
+			StorageClass: aws.StringValue(object.StorageClass),
+		}
+		if it.req.matches(info) {
+			it.page = append(it.page, info)
+		}
+	}
+}
+
+// matches reports whether info passes the filters of r. Size and time
+// filters only apply to objects, common prefixes are only matched against
+// the pattern, without their trailing delimiter.
+func (r *ListObjectsRequest) matches(info ObjectInfo) bool {
+	if r.Pattern != "" {
+		key := info.Key
+		if info.IsPrefix {
+			key = strings.TrimSuffix(key, r.Delimiter)
+		}
+		if ok, _ := path.Match(r.Pattern, key); !ok {
+			return false
+		}
+	}
+	if info.IsPrefix {
+		return true
+	}
+	if info.Size < r.MinSize || (r.MaxSize > 0 && info.Size > r.MaxSize) {
+		return false
+	}
+	if !r.ModifiedAfter.IsZero() && !info.LastModified.After(r.ModifiedAfter) {
+		return false
+	}
+	if !r.ModifiedBefore.IsZero() && !info.LastModified.Before(r.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// ListObjects returns every object and common prefix matching r, walking all
+// pages of the listing.
+func ListObjects(ctx context.Context, s3Session *s3.S3, r *ListObjectsRequest) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	it := NewObjectIterator(ctx, s3Session, r)
+	for it.Next() {
+		objects = append(objects, it.Object())
+	}
+	return objects, it.Err()
+}
@@ -0,0 +1,174 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Contents              []fakeObject   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+}
+
+// newFakeListing serves ListObjectsV2 for objects, with the continuation
+// token being the index of the next key.
+func newFakeListing(t *testing.T, objects []fakeObject) (*s3.S3, *int32) {
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		q := r.URL.Query()
+		prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+		maxKeys := 1000
+		if v := q.Get("max-keys"); v != "" {
+			maxKeys, _ = strconv.Atoi(v)
+		}
+		start, _ := strconv.Atoi(q.Get("continuation-token"))
+
+		result := listBucketResult{}
+		seen := map[string]bool{}
+		count := 0
+		for i := start; i < len(objects); i++ {
+			key := objects[i].Key
+			if !strings.HasPrefix(key, prefix) || key <= q.Get("start-after") {
+				continue
+			}
+			if count == maxKeys {
+				result.IsTruncated = true
+				result.NextContinuationToken = strconv.Itoa(i)
+				break
+			}
+			if idx := strings.Index(key[len(prefix):], delimiter); delimiter != "" && idx >= 0 {
+				common := key[:len(prefix)+idx+1]
+				if !seen[common] {
+					seen[common] = true
+					result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: common})
+					count++
+				}
+				continue
+			}
+			result.Contents = append(result.Contents, objects[i])
+			count++
+		}
+		xml.NewEncoder(w).Encode(result)
+	}))
+	t.Cleanup(server.Close)
+	return newTestClient(server.URL), &requests
+}
+
+func newTestClient(endpoint string) *s3.S3 {
+	return s3.New(session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(endpoint),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("AKIA", "secret", ""),
+	})))
+}
+
+func TestListObjects(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	var objects []fakeObject
+	for i := 0; i < 25; i++ {
+		objects = append(objects, fakeObject{Key: "builds/" + strconv.Itoa(100+i) + "/app.apk", Size: int64(i * 100), LastModified: now.Add(-time.Duration(i) * time.Hour)})
+	}
+	objects = append(objects, fakeObject{Key: "builds/125/app.aab", Size: 50, LastModified: now})
+	client, requests := newFakeListing(t, objects)
+	ctx := context.Background()
+
+	all, err := ListObjects(ctx, client, &ListObjectsRequest{BucketName: "artefacts", PageSize: 10})
+	assert.NoError(t, err)
+	assert.Len(t, all, 26)
+	assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+
+	folders, err := ListObjects(ctx, client, &ListObjectsRequest{BucketName: "artefacts", Prefix: "builds/", Delimiter: "/", PageSize: 7})
+	assert.NoError(t, err)
+	assert.Len(t, folders, 26)
+	assert.True(t, folders[0].IsPrefix)
+	assert.Equal(t, "builds/100/", folders[0].Key)
+
+	filtered, err := ListObjects(ctx, client, &ListObjectsRequest{
+		BucketName:    "artefacts",
+		StartAfter:    "builds/110/",
+		Pattern:       "builds/*/*.apk",
+		MinSize:       1200,
+		MaxSize:       2000,
+		ModifiedAfter: now.Add(-20 * time.Hour),
+	})
+	assert.NoError(t, err)
+	var keys []string
+	for _, object := range filtered {
+		keys = append(keys, object.Key)
+	}
+	assert.Equal(t, []string{"builds/112/app.apk", "builds/113/app.apk", "builds/114/app.apk", "builds/115/app.apk", "builds/116/app.apk", "builds/117/app.apk", "builds/118/app.apk", "builds/119/app.apk"}, keys)
+
+	// Folders are matched without their trailing delimiter
+	folders, err = ListObjects(ctx, client, &ListObjectsRequest{BucketName: "artefacts", Prefix: "builds/", Delimiter: "/", Pattern: "builds/11*"})
+	assert.NoError(t, err)
+	keys = nil
+	for _, folder := range folders {
+		assert.True(t, folder.IsPrefix)
+		keys = append(keys, folder.Key)
+	}
+	assert.Equal(t, []string{"builds/110/", "builds/111/", "builds/112/", "builds/113/", "builds/114/", "builds/115/", "builds/116/", "builds/117/", "builds/118/", "builds/119/"}, keys)
+
+	_, err = ListObjects(ctx, client, &ListObjectsRequest{BucketName: "artefacts", Pattern: "["})
+	assert.Error(t, err)
+
+	legacy, err := ListObjectsWithPrefix(client, &ListObjectsReq{BucketName: "artefacts", Prefix: "builds/", MaxKeys: 1500})
+	assert.NoError(t, err)
+	assert.Len(t, legacy, 26)
+}
+
+func TestObjectIterator(t *testing.T) {
+	var objects []fakeObject
+	for i := 0; i < 25; i++ {
+		objects = append(objects, fakeObject{Key: "logs/" + strconv.Itoa(100+i) + ".txt", Size: 10})
+	}
+	client, requests := newFakeListing(t, objects)
+
+	// Pages are only fetched as the iterator gets to them
+	it := NewObjectIterator(context.Background(), client, &ListObjectsRequest{BucketName: "artefacts", PageSize: 10})
+	var keys []string
+	for len(keys) < 12 && it.Next() {
+		keys = append(keys, it.Object().Key)
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, "logs/111.txt", keys[11])
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<Error><Code>NoSuchBucket</Code><Message>bucket not found</Message></Error>"))
+	}))
+	defer server.Close()
+	it = NewObjectIterator(context.Background(), newTestClient(server.URL), &ListObjectsRequest{BucketName: "missing"})
+	assert.False(t, it.Next())
+	assert.Error(t, it.Err())
+}
@@ -16,22 +16,29 @@ import (
 
 // UploadObjectToBucket uploads the provided object to S3 bucket. It either completely uploads the object to the bucket
 // and returns successfully or throws an error without any upload.
-func UploadObjectToBucket(s3Session *s3.S3, object *S3Object) error {
+// Bandwidth and progress can be tuned with TransferOptions
+func UploadObjectToBucket(s3Session *s3.S3, object *S3Object, opts ...TransferOption) error {
 	objectReq := &s3.PutObjectInput{
 		Bucket: object.Bucket,
 		Key:    object.Key,
 		Body:   bytes.NewReader(object.Body),
-		ACL:    aws.String(object.ACL),
+	}
+	// S3 compatible stores such as R2 reject an empty ACL header
+	if object.ACL != "" {
+		objectReq.ACL = aws.String(object.ACL)
 	}
 
 	if err := objectReq.Validate(); err != nil {
 		return err
 	}
 
-	_, err := s3Session.PutObject(objectReq)
+	cfg := transferConfig(0, 0, opts)
+	tracker := cfg.track(int64(len(object.Body)))
+	_, err := s3Session.PutObjectWithContext(aws.BackgroundContext(), objectReq, cfg.requestOptions()...)
 	if err != nil {
 		return err
 	}
+	tracker.Finish()
 
 	fmt.Printf("Successfully uploaded object with key %v to the bucket %v.\n", *object.Key, *object.Bucket)
 	return nil
@@ -41,13 +48,18 @@ func UploadObjectToBucket(s3Session *s3.S3, object *S3Object) error {
 // This is achieved by dividing the data into multiple parts and uploading them over
 // concurrent streams which is by default set to 5.
 // Set the desired location of source object/file along with key
-func UploadObjectMultipart(awsSess *session.Session, r *UploadMultipartObjectRequest) error {
+// Part size, concurrency, bandwidth and progress can be tuned with TransferOptions
+func UploadObjectMultipart(awsSess *session.Session, r *UploadMultipartObjectRequest, opts ...TransferOption) error {
 	file, err := os.Open(r.Source)
 	if err != nil {
 		fmt.Println("Error opening local file:", err)
 		return err
 	}
 	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
 
 	// Upload input parameters
 	upParams := &s3manager.UploadInput{
@@ -56,14 +68,15 @@ func UploadObjectMultipart(awsSess *session.Session, r *UploadMultipartObjectReq
 		Body:   file,
 	}
 
-	uploader := s3manager.NewUploader(awsSess, func(d *s3manager.Uploader) {
-		d.PartSize = 200 * 1024 * 1024 // 200MB per part
-	})
+	cfg := transferConfig(DEFAULT_PART_SIZE, DEFAULT_CONCURRENCY, opts)
+	tracker := cfg.track(info.Size())
+	uploader := cfg.uploader(awsSess, info.Size())
 
 	_, err = uploader.Upload(upParams)
 	if err != nil {
 		return err
 	}
+	tracker.Finish()
 
 	return nil
 }
@@ -73,13 +86,18 @@ func UploadObjectMultipart(awsSess *session.Session, r *UploadMultipartObjectReq
 // concurrent streams which is by default set to 5.
 // Set the desired location of source object/file along with key
 // Takes in a context to stop the request when context is expired
-func UploadObjectMultipartWithContext(ctx context.Context, awsSess *session.Session, r *UploadMultipartObjectRequest) error {
+// Part size, concurrency, bandwidth and progress can be tuned with TransferOptions
+func UploadObjectMultipartWithContext(ctx context.Context, awsSess *session.Session, r *UploadMultipartObjectRequest, opts ...TransferOption) error {
 	file, err := os.Open(r.Source)
 	if err != nil {
 		fmt.Println("Error opening local file:", err)
 		return err
 	}
 	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
 
 	// Upload input parameters
 	upParams := &s3manager.UploadInput{
@@ -88,21 +106,23 @@ func UploadObjectMultipartWithContext(ctx context.Context, awsSess *session.Sess
 		Body:   file,
 	}
 
-	uploader := s3manager.NewUploader(awsSess, func(d *s3manager.Uploader) {
-		d.PartSize = 200 * 1024 * 1024 // 200MB per part
-	})
+	cfg := transferConfig(DEFAULT_PART_SIZE, DEFAULT_CONCURRENCY, opts)
+	tracker := cfg.track(info.Size())
+	uploader := cfg.uploader(awsSess, info.Size())
 
 	_, err = uploader.UploadWithContext(ctx, upParams)
 	if err != nil {
 		return err
 	}
+	tracker.Finish()
 
 	return nil
 }
 
 // GetObject downloads the object data for the given object key from the bucket. To get an object with a
 // specific version id, set VersioningEnabled to true and provide the version id.
-func GetObject(s3Session *s3.S3, r *GetObjectRequest) (*GetObjectResponse, error) {
+// Bandwidth and progress can be tuned with TransferOptions
+func GetObject(s3Session *s3.S3, r *GetObjectRequest, opts ...TransferOption) (*GetObjectResponse, error) {
 	getObjectInput := &s3.GetObjectInput{
 		Bucket: aws.String(r.BucketName),
 		Key:    aws.String(r.ObjectName),
@@ -110,7 +130,9 @@ func GetObject(s3Session *s3.S3, r *GetObjectRequest) (*GetObjectResponse, error
 	if r.VersioningEnabled {
 		getObjectInput.VersionId = aws.String(r.VersionId)
 	}
-	resp, err := s3Session.GetObject(getObjectInput)
+	cfg := transferConfig(0, 0, opts)
+	tracker := cfg.track(0)
+	resp, err := s3Session.GetObjectWithContext(aws.BackgroundContext(), getObjectInput, cfg.requestOptions()...)
 	if err != nil {
 		return nil, err
 	}
@@ -118,6 +140,7 @@ func GetObject(s3Session *s3.S3, r *GetObjectRequest) (*GetObjectResponse, error
 	if err != nil {
 		return nil, err
 	}
+	tracker.Finish()
 	object := &GetObjectResponse{
 		Body: data,
 	}
@@ -128,7 +151,8 @@ func GetObject(s3Session *s3.S3, r *GetObjectRequest) (*GetObjectResponse, error
 // This is achieved by dividing the data into multiple parts and downloading them over
 // concurrent steams which is by default set to 5.
 // Set the desired location of downloaded data with destination
-func GetObjectMultipart(awsSess *session.Session, r *GetMultiPartObjectRequest) error {
+// Part size, concurrency, bandwidth and progress can be tuned with TransferOptions
+func GetObjectMultipart(awsSess *session.Session, r *GetMultiPartObjectRequest, opts ...TransferOption) error {
 	getObjectInput := &s3.GetObjectInput{
 		Bucket: aws.String(r.BucketName),
 		Key:    aws.String(r.ObjectName),
@@ -144,14 +168,15 @@ func GetObjectMultipart(awsSess *session.Session, r *GetMultiPartObjectRequest)
 
 	defer file.Close()
 
-	downloader := s3manager.NewDownloader(awsSess, func(d *s3manager.Downloader) {
-		d.PartSize = 200 * 1024 * 1024 // 200MB per part
-	})
+	cfg := transferConfig(DEFAULT_PART_SIZE, DEFAULT_CONCURRENCY, opts)
+	tracker := cfg.track(0)
+	downloader := cfg.downloader(awsSess)
 
 	_, err = downloader.Download(file, getObjectInput)
 	if err != nil {
 		return err
 	}
+	tracker.Finish()
 
 	return nil
 }
@@ -178,19 +203,27 @@ func DoesObjectExists(s3Session *s3.S3, r *ObjectExistsReq) (bool, error) {
 	return true, nil
 }
 
-// DoesObjectsWithPrefix return the list of objects that exist with the
-// given prefix
+// ListObjectsWithPrefix return the list of objects that exist with the
+// given prefix, walking every page of the listing until MaxKeys objects are
+// found, or all of them when MaxKeys is 0. Use ListObjects or an
+// ObjectIterator for filtering and folder listings.
 func ListObjectsWithPrefix(s3Session *s3.S3, r *ListObjectsReq) ([]*s3.Object, error) {
-	res, err := s3Session.ListObjectsV2(&s3.ListObjectsV2Input{
-		Bucket:  aws.String(r.BucketName),
-		Prefix:  aws.String(r.Prefix),
-		MaxKeys: aws.Int64(r.MaxKeys),
+	var objects []*s3.Object
+	err := s3Session.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(r.BucketName),
+		Prefix: aws.String(r.Prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		objects = append(objects, page.Contents...)
+		return r.MaxKeys == 0 || int64(len(objects)) < r.MaxKeys
 	})
 	if err != nil {
 		return nil, err
 	}
+	if r.MaxKeys > 0 && int64(len(objects)) > r.MaxKeys {
+		objects = objects[:r.MaxKeys]
+	}
 
-	return res.Contents, nil
+	return objects, nil
 }
 
 // GetObjectPresignedURL generates the public URL to download the object data for the given object key from the private bucket.
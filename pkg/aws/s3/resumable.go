@@ -0,0 +1,341 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const CHECKPOINT_FILE_SUFFIX = ".s3upload"
+
+// uploadCheckpoint is the state of a resumable upload persisted between
+// runs. It is only resumed for the same source file, destination and part
+// size.
+type uploadCheckpoint struct {
+	BucketName string           `json:"bucket"`
+	ObjectName string           `json:"key"`
+	UploadId   string           `json:"upload_id"`
+	Size       int64            `json:"size"`
+	ModTime    time.Time        `json:"mod_time"`
+	PartSize   int64            `json:"part_size"`
+	Parts      []checkpointPart `json:"parts"`
+}
+
+type checkpointPart struct {
+	Number int64  `json:"number"`
+	ETag   string `json:"etag"`
+	// MD5 of the part data, base64 encoded
+	MD5 string `json:"md5"`
+}
+
+// UploadResumable uploads the Source file in parts, persisting the upload id
+// and completed parts to a checkpoint file as it goes. When a previous run
+// of the same upload was interrupted, only the parts missing from the
+// multipart upload are sent. Parts are uploaded with their MD5 so S3 rejects
+// corrupted data, and checkpointed parts are only reused if the local data
+// still matches. The checkpoint is removed once the upload completes.
+func UploadResumable(ctx context.Context, s3Session *s3.S3, r *ResumableUploadRequest, opts ...TransferOption) error {
+	file, err := os.Open(r.Source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	checkpointFile := r.Checkpoint
+	if checkpointFile == "" {
+		checkpointFile = r.Source + CHECKPOINT_FILE_SUFFIX
+	}
+	cfg := transferConfig(DEFAULT_PART_SIZE, DEFAULT_CONCURRENCY, opts)
+	if r.PartSize > 0 {
+		cfg.PartSize = r.PartSize
+	}
+	if r.Concurrency > 0 {
+		cfg.Concurrency = r.Concurrency
+	}
+	partSize := CalculatePartSize(info.Size(), cfg.PartSize)
+	// S3 needs at least one part, which may be empty
+	partCount := (info.Size() + partSize - 1) / partSize
+	if partCount == 0 {
+		partCount = 1
+	}
+	// Only the last part may be smaller
+	if partCount > 1 && partSize < minUploadPartSize {
+		return fmt.Errorf("part size of %d bytes is below the minimum of %d bytes", partSize, minUploadPartSize)
+	}
+
+	checkpoint, done, err := resumeUpload(ctx, s3Session, file, checkpointFile, &uploadCheckpoint{
+		BucketName: r.BucketName,
+		ObjectName: r.ObjectName,
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UTC(),
+		PartSize:   partSize,
+	})
+	if err != nil {
+		return err
+	}
+	if checkpoint == nil {
+		input := &s3.CreateMultipartUploadInput{
+			Bucket: aws.String(r.BucketName),
+			Key:    aws.String(r.ObjectName),
+		}
+		if r.ContentType != "" {
+			input.ContentType = aws.String(r.ContentType)
+		}
+		upload, err := s3Session.CreateMultipartUploadWithContext(ctx, input)
+		if err != nil {
+			return fmt.Errorf("unable to start multipart upload: %v", err)
+		}
+		checkpoint = &uploadCheckpoint{
+			BucketName: r.BucketName,
+			ObjectName: r.ObjectName,
+			UploadId:   aws.StringValue(upload.UploadId),
+			Size:       info.Size(),
+			ModTime:    info.ModTime().UTC(),
+			PartSize:   partSize,
+		}
+		done = map[int64]checkpointPart{}
+		if err := saveCheckpoint(checkpointFile, checkpoint); err != nil {
+			return err
+		}
+	}
+
+	var missing []int64
+	for number := int64(1); number <= partCount; number++ {
+		if _, ok := done[number]; !ok {
+			missing = append(missing, number)
+		}
+	}
+
+	// Parts uploaded by earlier runs count as done
+	tracker := cfg.track(info.Size())
+	for _, part := range checkpoint.Parts {
+		tracker.Add(partReader(file, checkpoint, part.Number).Size())
+	}
+
+	var mu sync.Mutex
+	var uploadErr error
+	partCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	forEach(len(missing), cfg.Concurrency, func(i int) {
+		part, err := uploadPart(partCtx, s3Session, file, checkpoint, missing[i], cfg.requestOptions()...)
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil {
+			checkpoint.Parts = append(checkpoint.Parts, part)
+			err = saveCheckpoint(checkpointFile, checkpoint)
+		}
+		if err != nil && uploadErr == nil {
+			uploadErr = err
+			cancel()
+		}
+	})
+	if uploadErr != nil {
+		// The checkpoint is kept so the next run resumes from here
+		return fmt.Errorf("unable to upload %s, resume from %s: %v", r.Source, checkpointFile, uploadErr)
+	}
+
+	sort.Slice(checkpoint.Parts, func(i, j int) bool { return checkpoint.Parts[i].Number < checkpoint.Parts[j].Number })
+	completed := make([]*s3.CompletedPart, len(checkpoint.Parts))
+	for i, part := range checkpoint.Parts {
+		completed[i] = &s3.CompletedPart{ETag: aws.String(part.ETag), PartNumber: aws.Int64(part.Number)}
+	}
+	_, err = s3Session.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(r.BucketName),
+		Key:             aws.String(r.ObjectName),
+		UploadId:        aws.String(checkpoint.UploadId),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to complete multipart upload: %v", err)
+	}
+	tracker.Finish()
+	return os.Remove(checkpointFile)
+}
+
+// resumeUpload loads the checkpoint and returns it along with the parts
+// that do not need to be uploaded again. A nil checkpoint means the upload
+// has to start over, in which case any upload of an outdated checkpoint is
+// aborted.
+func resumeUpload(ctx context.Context, s3Session *s3.S3, file *os.File, checkpointFile string, want *uploadCheckpoint) (*uploadCheckpoint, map[int64]checkpointPart, error) {
+	data, err := ioutil.ReadFile(checkpointFile)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read checkpoint: %v", err)
+	}
+	checkpoint := &uploadCheckpoint{}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, nil, fmt.Errorf("unable to parse checkpoint %s: %v", checkpointFile, err)
+	}
+
+	if checkpoint.BucketName != want.BucketName || checkpoint.ObjectName != want.ObjectName || checkpoint.Size != want.Size ||
+		!checkpoint.ModTime.Equal(want.ModTime) || checkpoint.PartSize != want.PartSize {
+		// Best effort, AbortStaleMultipartUploads cleans up otherwise
+		_, _ = s3Session.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(checkpoint.BucketName),
+			Key:      aws.String(checkpoint.ObjectName),
+			UploadId: aws.String(checkpoint.UploadId),
+		})
+		return nil, nil, nil
+	}
+
+	// Only trust parts S3 still has with the checkpointed ETag
+	uploaded := map[int64]string{}
+	err = s3Session.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(checkpoint.BucketName),
+		Key:      aws.String(checkpoint.ObjectName),
+		UploadId: aws.String(checkpoint.UploadId),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			uploaded[aws.Int64Value(part.PartNumber)] = aws.StringValue(part.ETag)
+		}
+		return true
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchUpload {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list uploaded parts: %v", err)
+	}
+
+	done := map[int64]checkpointPart{}
+	var parts []checkpointPart
+	for _, part := range checkpoint.Parts {
+		if uploaded[part.Number] != part.ETag {
+			continue
+		}
+		sum, err := partMD5(file, checkpoint, part.Number)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sum == part.MD5 {
+			done[part.Number] = part
+			parts = append(parts, part)
+		}
+	}
+	checkpoint.Parts = parts
+	return checkpoint, done, nil
+}
+
+func uploadPart(ctx context.Context, s3Session *s3.S3, file *os.File, checkpoint *uploadCheckpoint, number int64, opts ...request.Option) (checkpointPart, error) {
+	sum, err := partMD5(file, checkpoint, number)
+	if err != nil {
+		return checkpointPart{}, err
+	}
+	res, err := s3Session.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(checkpoint.BucketName),
+		Key:        aws.String(checkpoint.ObjectName),
+		UploadId:   aws.String(checkpoint.UploadId),
+		PartNumber: aws.Int64(number),
+		Body:       partReader(file, checkpoint, number),
+		ContentMD5: aws.String(sum),
+	}, opts...)
+	if err != nil {
+		return checkpointPart{}, fmt.Errorf("unable to upload part %d: %v", number, err)
+	}
+	return checkpointPart{Number: number, ETag: aws.StringValue(res.ETag), MD5: sum}, nil
+}
+
+func partReader(file *os.File, checkpoint *uploadCheckpoint, number int64) *io.SectionReader {
+	offset := (number - 1) * checkpoint.PartSize
+	size := checkpoint.PartSize
+	if offset+size > checkpoint.Size {
+		size = checkpoint.Size - offset
+	}
+	return io.NewSectionReader(file, offset, size)
+}
+
+func partMD5(file *os.File, checkpoint *uploadCheckpoint, number int64) (string, error) {
+	hash := md5.New()
+	if _, err := io.Copy(hash, partReader(file, checkpoint, number)); err != nil {
+		return "", fmt.Errorf("unable to read part %d: %v", number, err)
+	}
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil)), nil
+}
+
+// saveCheckpoint writes the checkpoint through a temporary file, so a crash
+// never leaves a truncated checkpoint behind.
+func saveCheckpoint(filename string, checkpoint *uploadCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to save checkpoint: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to save checkpoint: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to save checkpoint: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("unable to save checkpoint: %v", err)
+	}
+	return nil
+}
+
+// AbortStaleMultipartUploads aborts every multipart upload of the bucket
+// initiated more than olderThan ago, so the parts of uploads that were never
+// completed or resumed stop being billed. It returns the uploads aborted.
+func AbortStaleMultipartUploads(ctx context.Context, s3Session *s3.S3, bucket string, olderThan time.Duration) ([]MultipartUpload, error) {
+	cutoff := time.Now().Add(-olderThan)
+	var stale []MultipartUpload
+	err := s3Session.ListMultipartUploadsPagesWithContext(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+	}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, upload := range page.Uploads {
+			if initiated := aws.TimeValue(upload.Initiated); initiated.Before(cutoff) {
+				stale = append(stale, MultipartUpload{
+					Key:       aws.StringValue(upload.Key),
+					UploadId:  aws.StringValue(upload.UploadId),
+					Initiated: initiated,
+				})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list multipart uploads: %v", err)
+	}
+
+	var aborted []MultipartUpload
+	for _, upload := range stale {
+		_, err := s3Session.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(upload.Key),
+			UploadId: aws.String(upload.UploadId),
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchUpload {
+			// Completed or aborted in the meantime
+			continue
+		}
+		if err != nil {
+			return aborted, fmt.Errorf("unable to abort upload of %s: %v", upload.Key, err)
+		}
+		aborted = append(aborted, upload)
+	}
+	return aborted, nil
+}
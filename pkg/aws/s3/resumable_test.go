@@ -0,0 +1,228 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMultipart serves just enough of the multipart upload API to upload,
+// resume and abort uploads, along with single request uploads.
+type fakeMultipart struct {
+	mu        sync.Mutex
+	uploads   map[string]map[int64][]byte
+	initiated map[string]time.Time
+	keys      map[string]string
+	objects   map[string][]byte
+	calls     []int64
+	aborted   []string
+	failPart  int64
+	// flakyPart fails once after its data was received, so it is retried
+	flakyPart int64
+	nextID    int
+}
+
+func newFakeMultipart(t *testing.T) (*fakeMultipart, *httptest.Server) {
+	fake := &fakeMultipart{
+		uploads:   map[string]map[int64][]byte{},
+		initiated: map[string]time.Time{},
+		keys:      map[string]string{},
+		objects:   map[string][]byte{},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeMultipart) start(key string, initiated time.Time) string {
+	f.nextID++
+	id := "upload-" + strconv.Itoa(f.nextID)
+	f.uploads[id] = map[int64][]byte{}
+	f.initiated[id] = initiated
+	f.keys[id] = key
+	return id
+}
+
+func (f *fakeMultipart) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	query := r.URL.Query()
+	id := query.Get("uploadId")
+	key := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[1:]
+	if id != "" && f.uploads[id] == nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<Error><Code>NoSuchUpload</Code><Message>upload not found</Message></Error>")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", f.start(key[0], time.Now()))
+	case r.Method == http.MethodGet && query.Has("uploads"):
+		fmt.Fprint(w, "<ListMultipartUploadsResult>")
+		for id, initiated := range f.initiated {
+			fmt.Fprintf(w, "<Upload><Key>%s</Key><UploadId>%s</UploadId><Initiated>%s</Initiated></Upload>", f.keys[id], id, initiated.UTC().Format(time.RFC3339))
+		}
+		fmt.Fprint(w, "</ListMultipartUploadsResult>")
+	case r.Method == http.MethodPut && id == "":
+		data, _ := ioutil.ReadAll(r.Body)
+		f.objects[key[0]] = data
+	case r.Method == http.MethodPut:
+		number, _ := strconv.ParseInt(query.Get("partNumber"), 10, 64)
+		data, _ := ioutil.ReadAll(r.Body)
+		sum := md5.Sum(data)
+		if number == f.failPart || r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "<Error><Code>BadDigest</Code><Message>part rejected</Message></Error>")
+			return
+		}
+		if number == f.flakyPart {
+			f.flakyPart = 0
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "<Error><Code>InternalError</Code><Message>try again</Message></Error>")
+			return
+		}
+		f.calls = append(f.calls, number)
+		f.uploads[id][number] = data
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == http.MethodGet:
+		fmt.Fprint(w, "<ListPartsResult>")
+		for number, data := range f.uploads[id] {
+			sum := md5.Sum(data)
+			fmt.Fprintf(w, "<Part><PartNumber>%d</PartNumber><ETag>&quot;%s&quot;</ETag></Part>", number, hex.EncodeToString(sum[:]))
+		}
+		fmt.Fprint(w, "</ListPartsResult>")
+	case r.Method == http.MethodPost:
+		var body struct {
+			Parts []struct{ PartNumber int64 } `xml:"Part"`
+		}
+		xml.NewDecoder(r.Body).Decode(&body)
+		var object []byte
+		for _, part := range body.Parts {
+			object = append(object, f.uploads[id][part.PartNumber]...)
+		}
+		f.objects[key[0]] = object
+		delete(f.uploads, id)
+		delete(f.initiated, id)
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete:
+		f.aborted = append(f.aborted, id)
+		delete(f.uploads, id)
+		delete(f.initiated, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeMultipart) takeCalls() []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+func TestUploadResumable(t *testing.T) {
+	lowerMinPartSize(t)
+	fake, server := newFakeMultipart(t)
+	client := newTestClient(server.URL)
+	ctx := context.Background()
+
+	source := filepath.Join(t.TempDir(), "app.aab")
+	content := bytes.Repeat([]byte("0123456789"), 1010)
+	assert.NoError(t, os.WriteFile(source, content, 0644))
+	req := &ResumableUploadRequest{BucketName: "artefacts", ObjectName: "builds/app.aab", Source: source, PartSize: 1024, Concurrency: 1}
+
+	// The runner "dies" at part 5, keeping the first four
+	fake.failPart = 5
+	assert.Error(t, UploadResumable(ctx, client, req))
+	assert.Equal(t, []int64{1, 2, 3, 4}, fake.takeCalls())
+	assert.FileExists(t, source+CHECKPOINT_FILE_SUFFIX)
+
+	// A part whose checksum no longer matches is uploaded again
+	var checkpoint uploadCheckpoint
+	data, _ := ioutil.ReadFile(source + CHECKPOINT_FILE_SUFFIX)
+	assert.NoError(t, json.Unmarshal(data, &checkpoint))
+	checkpoint.Parts[1].MD5 = "corrupt"
+	assert.NoError(t, saveCheckpoint(source+CHECKPOINT_FILE_SUFFIX, &checkpoint))
+
+	fake.failPart = 0
+	assert.NoError(t, UploadResumable(ctx, client, req))
+	calls := fake.takeCalls()
+	assert.ElementsMatch(t, []int64{checkpoint.Parts[1].Number, 5, 6, 7, 8, 9, 10}, calls)
+	assert.True(t, bytes.Equal(content, fake.objects["builds/app.aab"]))
+	assert.NoFileExists(t, source+CHECKPOINT_FILE_SUFFIX)
+	assert.Empty(t, fake.aborted)
+
+	// A checkpoint of an earlier version of the file starts over
+	fake.failPart = 3
+	assert.Error(t, UploadResumable(ctx, client, req))
+	fake.takeCalls()
+	assert.NoError(t, os.WriteFile(source, append(content, "changed"...), 0644))
+	fake.failPart = 0
+	assert.NoError(t, UploadResumable(ctx, client, req))
+	assert.Len(t, fake.takeCalls(), 10)
+	assert.Len(t, fake.aborted, 1)
+	assert.Equal(t, string(content)+"changed", string(fake.objects["builds/app.aab"]))
+}
+
+func TestUploadResumablePartSize(t *testing.T) {
+	fake, server := newFakeMultipart(t)
+	client := newTestClient(server.URL)
+	ctx := context.Background()
+
+	// An empty file is uploaded as a single empty part with the default size
+	source := filepath.Join(t.TempDir(), "empty.txt")
+	assert.NoError(t, os.WriteFile(source, nil, 0644))
+	assert.NoError(t, UploadResumable(ctx, client, &ResumableUploadRequest{BucketName: "artefacts", ObjectName: "empty.txt", Source: source}, WithPartSize(0)))
+	assert.Equal(t, []int64{1}, fake.takeCalls())
+	assert.Empty(t, fake.objects["empty.txt"])
+
+	// A file that fits in a single part may use any part size
+	small := filepath.Join(t.TempDir(), "small.txt")
+	assert.NoError(t, os.WriteFile(small, bytes.Repeat([]byte("x"), 1000), 0644))
+	assert.NoError(t, UploadResumable(ctx, client, &ResumableUploadRequest{BucketName: "artefacts", ObjectName: "small.txt", Source: small, PartSize: 1024}))
+	assert.Equal(t, []int64{1}, fake.takeCalls())
+	assert.Len(t, fake.objects["small.txt"], 1000)
+
+	// S3 would only reject parts that are too small once the upload completes
+	assert.NoError(t, os.WriteFile(small, bytes.Repeat([]byte("x"), 3000), 0644))
+	assert.Error(t, UploadResumable(ctx, client, &ResumableUploadRequest{BucketName: "artefacts", ObjectName: "small.txt", Source: small, PartSize: 1024}))
+	assert.Error(t, UploadResumable(ctx, client, &ResumableUploadRequest{BucketName: "artefacts", ObjectName: "small.txt", Source: small}, WithPartSize(1024)))
+	assert.Empty(t, fake.takeCalls())
+	assert.Equal(t, 2, fake.nextID)
+	assert.NoFileExists(t, small+CHECKPOINT_FILE_SUFFIX)
+}
+
+func TestAbortStaleMultipartUploads(t *testing.T) {
+	fake, server := newFakeMultipart(t)
+	client := newTestClient(server.URL)
+
+	stale := fake.start("builds/old.ipa", time.Now().Add(-48*time.Hour))
+	fake.start("builds/new.ipa", time.Now())
+
+	aborted, err := AbortStaleMultipartUploads(context.Background(), client, "artefacts", 24*time.Hour)
+	assert.NoError(t, err)
+	if assert.Len(t, aborted, 1) {
+		assert.Equal(t, "builds/old.ipa", aborted[0].Key)
+		assert.Equal(t, stale, aborted[0].UploadId)
+	}
+	assert.Equal(t, []string{stale}, fake.aborted)
+	assert.Len(t, fake.uploads, 1)
+}
@@ -0,0 +1,204 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	sharedAws "github.com/dashwave/sharedlib/pkg/aws"
+	"github.com/dashwave/sharedlib/pkg/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testBucketName = "sharedlib-test-bucket"
+	testObjectName = "test-object.txt"
+	testContent    = "Hello, S3!"
+)
+
+// setupTestSession connects to the S3 compatible store at S3_TEST_ENDPOINT,
+// such as a MinIO container started with
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//
+// and S3_TEST_ACCESS_KEY_ID=minioadmin S3_TEST_SECRET_ACCESS_KEY=minioadmin.
+func setupTestSession(t *testing.T) *session.Session {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+
+	sharedAws.DefaultAccounts.Register("TEST-VAULT", sharedAws.Account{Path: "TEST-ACCOUNT", Endpoint: endpoint, PathStyle: true})
+	t.Cleanup(func() { sharedAws.DefaultAccounts.Unregister("TEST-VAULT") })
+	store := vault.NewMemoryStore(map[string]vault.VaultSecretMap{
+		"TEST-ACCOUNT": {
+			sharedAws.AWS_ACCESS_KEY_ID:     os.Getenv("S3_TEST_ACCESS_KEY_ID"),
+			sharedAws.AWS_SECRET_ACCESS_KEY: os.Getenv("S3_TEST_SECRET_ACCESS_KEY"),
+		},
+	})
+	sess, _, err := ConnectAws(store, "us-east-1", "TEST-VAULT")
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", endpoint, err)
+	}
+	return sess
+}
+
+func TestS3CompatibleStore(t *testing.T) {
+	sess := setupTestSession(t)
+	client := s3.New(sess)
+
+	assert.NoError(t, CreateBucket(client, &CreateBucketConfiguration{Name: testBucketName}))
+
+	assert.NoError(t, UploadObjectToBucket(client, &S3Object{
+		Bucket: aws.String(testBucketName),
+		Key:    aws.String(testObjectName),
+		Body:   []byte(testContent),
+	}))
+
+	exists, err := DoesObjectExists(client, &ObjectExistsReq{BucketName: testBucketName, ObjectName: testObjectName})
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = DoesObjectExists(client, &ObjectExistsReq{BucketName: testBucketName, ObjectName: "missing.txt"})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	resp, err := GetObject(client, &GetObjectRequest{BucketName: testBucketName, ObjectName: testObjectName})
+	assert.NoError(t, err)
+	if err == nil {
+		assert.Equal(t, testContent, string(resp.Body))
+	}
+
+	objects, err := ListObjectsWithPrefix(client, &ListObjectsReq{BucketName: testBucketName, Prefix: "test", MaxKeys: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 1) {
+		assert.Equal(t, testObjectName, *objects[0].Key)
+	}
+
+	url, err := GetObjectPresignedURL(client, &GetObjectRequest{BucketName: testBucketName, ObjectName: testObjectName, Duration: time.Minute})
+	assert.NoError(t, err)
+	if presigned, err := http.Get(url); assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(presigned.Body)
+		presigned.Body.Close()
+		assert.Equal(t, testContent, string(body))
+	}
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "upload.txt")
+	assert.NoError(t, os.WriteFile(source, []byte(strings.Repeat(testContent, 1000)), 0644))
+	assert.NoError(t, UploadObjectMultipart(sess, &UploadMultipartObjectRequest{BucketName: testBucketName, ObjectName: "multipart.txt", Source: source}))
+	assert.NoError(t, UploadObjectMultipartWithContext(context.Background(), sess, &UploadMultipartObjectRequest{BucketName: testBucketName, ObjectName: "multipart-ctx.txt", Source: source}))
+
+	destination := filepath.Join(dir, "download.txt")
+	assert.NoError(t, GetObjectMultipart(sess, &GetMultiPartObjectRequest{BucketName: testBucketName, ObjectName: "multipart.txt", Destination: destination}))
+	content, err := os.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat(testContent, 1000), string(content))
+
+	// Stream an artefact through a pipe, larger than a single part
+	artefact := strings.Repeat("0123456789abcdef", 2*DEFAULT_STREAM_PART_SIZE/16+1)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeChunks(pw, artefact, 1<<20))
+	}()
+	assert.NoError(t, UploadStream(context.Background(), sess, pr, &UploadStreamRequest{
+		BucketName:  testBucketName,
+		ObjectName:  "stream.bin",
+		ContentType: "application/octet-stream",
+		Metadata:    map[string]string{"Build": "42"},
+	}))
+
+	object, err := OpenObject(context.Background(), client, &GetObjectRequest{BucketName: testBucketName, ObjectName: "stream.bin"})
+	if assert.NoError(t, err) {
+		data, err := ioutil.ReadAll(object)
+		object.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(artefact)), object.ContentLength)
+		assert.Equal(t, "application/octet-stream", object.ContentType)
+		assert.Equal(t, "42", object.Metadata["Build"])
+		assert.True(t, string(data) == artefact)
+	}
+
+	var buf bytes.Buffer
+	n, err := DownloadTo(context.Background(), sess, &buf, &GetObjectRequest{BucketName: testBucketName, ObjectName: "stream.bin"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(artefact)), n)
+	assert.True(t, buf.String() == artefact)
+
+	file, err := os.Create(filepath.Join(dir, "stream.bin"))
+	assert.NoError(t, err)
+	n, err = DownloadTo(context.Background(), sess, file, &GetObjectRequest{BucketName: testBucketName, ObjectName: "stream.bin"})
+	file.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(artefact)), n)
+
+	ctx := context.Background()
+	assert.NoError(t, UploadResumable(ctx, client, &ResumableUploadRequest{BucketName: testBucketName, ObjectName: "resumable.txt", Source: source}))
+	assert.NoFileExists(t, source+CHECKPOINT_FILE_SUFFIX)
+	_, err = AbortStaleMultipartUploads(ctx, client, testBucketName, time.Hour)
+	assert.NoError(t, err)
+
+	listed, err := ListObjects(ctx, client, &ListObjectsRequest{BucketName: testBucketName, Pattern: "multipart*.txt", PageSize: 1})
+	assert.NoError(t, err)
+	var listedKeys []string
+	for _, object := range listed {
+		listedKeys = append(listedKeys, object.Key)
+	}
+	assert.Equal(t, []string{"multipart-ctx.txt", "multipart.txt"}, listedKeys)
+
+	// Copy artefacts into a build folder, then move and clean it up
+	for _, key := range []string{"builds/1/app.txt", "builds/1/logs/build.txt"} {
+		assert.NoError(t, CopyObject(ctx, client, &CopyObjectRequest{SourceBucket: testBucketName, SourceKey: testObjectName, BucketName: testBucketName, ObjectName: key}))
+	}
+	moved, err := MovePrefix(ctx, client, &MovePrefixRequest{SourceBucket: testBucketName, Prefix: "builds/1/", DestinationPrefix: "archive/1/", DryRun: true})
+	assert.NoError(t, err)
+	assert.Len(t, moved.Moved, 2)
+	_, err = MovePrefix(ctx, client, &MovePrefixRequest{SourceBucket: testBucketName, Prefix: "builds/", DestinationPrefix: "builds/old/"})
+	assert.Error(t, err)
+
+	moved, err = MovePrefix(ctx, client, &MovePrefixRequest{SourceBucket: testBucketName, Prefix: "builds/1/", DestinationPrefix: "archive/1/"})
+	assert.NoError(t, err)
+	assert.Equal(t, []ObjectMove{
+		{Source: "builds/1/app.txt", Destination: "archive/1/app.txt"},
+		{Source: "builds/1/logs/build.txt", Destination: "archive/1/logs/build.txt"},
+	}, moved.Moved)
+	exists, err = DoesObjectExists(client, &ObjectExistsReq{BucketName: testBucketName, ObjectName: "builds/1/app.txt"})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	if resp, err := GetObject(client, &GetObjectRequest{BucketName: testBucketName, ObjectName: "archive/1/logs/build.txt"}); assert.NoError(t, err) {
+		assert.Equal(t, testContent, string(resp.Body))
+	}
+
+	deleted, err := DeletePrefix(ctx, client, &DeletePrefixRequest{BucketName: testBucketName, Prefix: "archive/"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"archive/1/app.txt", "archive/1/logs/build.txt"}, deleted.Deleted)
+
+	assert.NoError(t, DeleteObject(ctx, client, &DeleteObjectRequest{BucketName: testBucketName, ObjectName: testObjectName}))
+	deleted, err = DeleteObjects(ctx, client, &DeleteObjectsRequest{BucketName: testBucketName, Keys: []string{"multipart.txt", "multipart-ctx.txt", "resumable.txt", "stream.bin"}})
+	assert.NoError(t, err)
+	assert.Empty(t, deleted.Errors)
+	assert.NoError(t, DeleteBucket(client, testBucketName))
+}
+
+func writeChunks(w io.Writer, data string, size int) error {
+	for len(data) > 0 {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := io.WriteString(w, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// DEFAULT_STREAM_PART_SIZE is the part size of streamed uploads and
+// downloads. Up to 5 parts are buffered in memory at a time, and objects of
+// up to 160GB can be uploaded.
+const DEFAULT_STREAM_PART_SIZE = 16 * 1024 * 1024
+
+// UploadStream uploads everything read from body until io.EOF to the bucket,
+// without knowing its size upfront. Large bodies are uploaded in parts over
+// concurrent streams, so only a few parts are held in memory at a time.
+func UploadStream(ctx context.Context, awsSess *session.Session, body io.Reader, r *UploadStreamRequest, opts ...TransferOption) error {
+	upParams := &s3manager.UploadInput{
+		Bucket:   aws.String(r.BucketName),
+		Key:      aws.String(r.ObjectName),
+		Body:     body,
+		Metadata: aws.StringMap(r.Metadata),
+	}
+	if r.ContentType != "" {
+		upParams.ContentType = aws.String(r.ContentType)
+	}
+	if r.ACL != "" {
+		upParams.ACL = aws.String(r.ACL)
+	}
+
+	cfg := transferConfig(DEFAULT_STREAM_PART_SIZE, DEFAULT_CONCURRENCY, opts)
+	tracker := cfg.track(0)
+	if _, err := cfg.uploader(awsSess, 0).UploadWithContext(ctx, upParams); err != nil {
+		return err
+	}
+	tracker.Finish()
+	return nil
+}
+
+// DownloadTo writes the object data to w and returns the number of bytes
+// written. When w is an io.WriterAt, such as a regular *os.File, parts are
+// downloaded over concurrent streams, otherwise the object is streamed in
+// order over a single connection, e.g. into a pipe or stdout.
+func DownloadTo(ctx context.Context, awsSess *session.Session, w io.Writer, r *GetObjectRequest, opts ...TransferOption) (int64, error) {
+	getObjectInput := getObjectInput(r)
+	cfg := transferConfig(DEFAULT_STREAM_PART_SIZE, DEFAULT_CONCURRENCY, opts)
+	tracker := cfg.track(0)
+
+	var n int64
+	var err error
+	if wa, ok := writerAt(w); ok {
+		n, err = cfg.downloader(awsSess).DownloadWithContext(ctx, wa, getObjectInput)
+	} else {
+		var resp *s3.GetObjectOutput
+		resp, err = s3.New(awsSess).GetObjectWithContext(ctx, getObjectInput, cfg.requestOptions()...)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		n, err = io.Copy(w, resp.Body)
+	}
+	if err == nil {
+		tracker.Finish()
+	}
+	return n, err
+}
+
+// writerAt returns w when parts can be written to it at any offset. Every
+// *os.File is an io.WriterAt, but WriteAt fails on pipes, terminals and
+// files opened with O_APPEND.
+func writerAt(w io.Writer) (io.WriterAt, bool) {
+	wa, ok := w.(io.WriterAt)
+	if !ok {
+		return nil, false
+	}
+	if f, ok := w.(*os.File); ok {
+		if _, err := f.Seek(0, io.SeekCurrent); err != nil {
+			return nil, false
+		}
+		// An empty write only fails when the file is in append mode
+		if _, err := f.WriteAt(nil, 0); err != nil {
+			return nil, false
+		}
+	}
+	return wa, true
+}
+
+// OpenObject returns a reader streaming the object data, along with its
+// metadata. Reads fail once ctx is done. Only the bandwidth limit and
+// progress of the transfer options apply, as the object is read over a single
+// connection. Progress is reported as the reader is read, without a final
+// update.
+func OpenObject(ctx context.Context, s3Session *s3.S3, r *GetObjectRequest, opts ...TransferOption) (*ObjectReader, error) {
+	cfg := transferConfig(0, 0, opts)
+	cfg.track(0)
+	resp, err := s3Session.GetObjectWithContext(ctx, getObjectInput(r), cfg.requestOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectReader{
+		ReadCloser:    resp.Body,
+		ContentLength: aws.Int64Value(resp.ContentLength),
+		ContentType:   aws.StringValue(resp.ContentType),
+		ETag:          aws.StringValue(resp.ETag),
+		VersionId:     aws.StringValue(resp.VersionId),
+		LastModified:  aws.TimeValue(resp.LastModified),
+		Metadata:      aws.StringValueMap(resp.Metadata),
+	}, nil
+}
+
+func getObjectInput(r *GetObjectRequest) *s3.GetObjectInput {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(r.BucketName),
+		Key:    aws.String(r.ObjectName),
+	}
+	if r.VersioningEnabled {
+		input.VersionId = aws.String(r.VersionId)
+	}
+	return input
+}
@@ -0,0 +1,95 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSession(endpoint string) *session.Session {
+	return session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(endpoint),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("AKIA", "secret", ""),
+	}))
+}
+
+func TestUploadStream(t *testing.T) {
+	fake, server := newFakeMultipart(t)
+	sess := newTestSession(server.URL)
+	ctx := context.Background()
+
+	// A body smaller than a part is uploaded in a single request
+	assert.NoError(t, UploadStream(ctx, sess, bytes.NewReader([]byte("build log")), &UploadStreamRequest{BucketName: "artefacts", ObjectName: "build.log"}))
+	assert.Equal(t, "build log", string(fake.objects["build.log"]))
+	assert.Empty(t, fake.takeCalls())
+
+	// A body of unknown size is cut into parts as it is read
+	content := bytes.Repeat([]byte("0123456789abcdef"), 11*1024*1024/16)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeChunks(pw, string(content), 1<<20))
+	}()
+	assert.NoError(t, UploadStream(ctx, sess, pr, &UploadStreamRequest{BucketName: "artefacts", ObjectName: "app.apk"}, WithPartSize(5*1024*1024)))
+	assert.ElementsMatch(t, []int64{1, 2, 3}, fake.takeCalls())
+	assert.True(t, bytes.Equal(content, fake.objects["app.apk"]))
+}
+
+func TestDownloadToPipe(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "app.apk", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	sess := newTestSession(server.URL)
+	ctx := context.Background()
+	req := &GetObjectRequest{BucketName: "artefacts", ObjectName: "app.apk"}
+
+	// Pipes are files too, but cannot be written at an offset
+	pr, pw, err := os.Pipe()
+	assert.NoError(t, err)
+	received := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(pr)
+		received <- data
+	}()
+	n, err := DownloadTo(ctx, sess, pw, req, WithPartSize(256*1024))
+	pw.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	assert.True(t, bytes.Equal(content, <-received))
+
+	// Neither can files opened for appending
+	path := filepath.Join(t.TempDir(), "app.apk")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	_, err = DownloadTo(ctx, sess, file, req, WithPartSize(256*1024))
+	file.Close()
+	assert.NoError(t, err)
+
+	// Regular files are downloaded in concurrent parts
+	file, err = os.Create(path + ".parts")
+	assert.NoError(t, err)
+	_, err = DownloadTo(ctx, sess, file, req, WithPartSize(256*1024))
+	file.Close()
+	assert.NoError(t, err)
+
+	for _, name := range []string{path, path + ".parts"} {
+		data, err := os.ReadFile(name)
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(content, data), name)
+	}
+}
@@ -0,0 +1,277 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/dashwave/sharedlib/pkg/progress"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DEFAULT_PART_SIZE is the part size of file uploads and downloads
+	DEFAULT_PART_SIZE   = 200 * 1024 * 1024
+	DEFAULT_CONCURRENCY = s3manager.DefaultUploadConcurrency
+
+	// limiterChunk is the most bytes read at once under a bandwidth limit,
+	// so transfers are throttled smoothly instead of in bursts
+	limiterChunk = 64 * 1024
+)
+
+// minUploadPartSize is the smallest part size uploads accept, as S3 rejects
+// every part but the last one below s3manager.MinUploadPartSize. Tests lower
+// it to upload small files in parts.
+var minUploadPartSize int64 = s3manager.MinUploadPartSize
+
+// TransferConfig tunes multipart transfers. Zero fields fall back to the
+// process defaults set with SetTransferDefaults, then to the defaults of the
+// transfer.
+type TransferConfig struct {
+	PartSize    int64
+	Concurrency int
+	// Limiter caps the bandwidth used. Share one limiter between transfers
+	// to cap their combined bandwidth.
+	Limiter *rate.Limiter
+
+	// Progress is only set per call, with WithProgress
+	progress         progress.Func
+	progressInterval time.Duration
+	tracker          *progress.Tracker
+}
+
+// TransferOption overrides the transfer settings of a single call.
+type TransferOption func(*TransferConfig)
+
+// WithPartSize sets the part size of a transfer. It is raised for uploads
+// that would need more than s3manager.MaxUploadParts parts, and uploads
+// reject part sizes below s3manager.MinUploadPartSize. A part size of 0
+// keeps the default.
+func WithPartSize(partSize int64) TransferOption {
+	return func(c *TransferConfig) {
+		c.PartSize = partSize
+	}
+}
+
+// WithConcurrency sets the number of parts transferred at a time.
+func WithConcurrency(concurrency int) TransferOption {
+	return func(c *TransferConfig) {
+		c.Concurrency = concurrency
+	}
+}
+
+// WithBandwidthLimit caps the bandwidth of a transfer to bytesPerSecond,
+// across all of its parts.
+func WithBandwidthLimit(bytesPerSecond int64) TransferOption {
+	return func(c *TransferConfig) {
+		c.Limiter = NewBandwidthLimiter(bytesPerSecond)
+	}
+}
+
+// WithLimiter caps the bandwidth of a transfer with a limiter that may be
+// shared with other transfers.
+func WithLimiter(limiter *rate.Limiter) TransferOption {
+	return func(c *TransferConfig) {
+		c.Limiter = limiter
+	}
+}
+
+// WithProgress reports the bytes transferred, throughput and ETA of a
+// transfer to fn, at most once per interval, or progress.DEFAULT_INTERVAL
+// when interval is 0. Use progress.Channel to receive updates on a channel.
+func WithProgress(fn progress.Func, interval time.Duration) TransferOption {
+	return func(c *TransferConfig) {
+		c.progress = fn
+		c.progressInterval = interval
+	}
+}
+
+// NewBandwidthLimiter returns a token bucket limiter allowing bytesPerSecond
+// on average, with bursts of up to a second worth of bytes.
+func NewBandwidthLimiter(bytesPerSecond int64) *rate.Limiter {
+	burst := int(bytesPerSecond)
+	if burst < limiterChunk {
+		burst = limiterChunk
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
+
+var (
+	transferDefaultsMu sync.RWMutex
+	transferDefaults   TransferConfig
+)
+
+// SetTransferDefaults sets the transfer settings of every call in the
+// process that does not override them. A Limiter set here is shared, capping
+// the combined bandwidth of all those transfers.
+func SetTransferDefaults(c TransferConfig) {
+	transferDefaultsMu.Lock()
+	defer transferDefaultsMu.Unlock()
+	transferDefaults = c
+}
+
+// transferConfig resolves the settings of a call, from the given defaults of
+// the transfer, the process defaults and the call options.
+func transferConfig(partSize int64, concurrency int, opts []TransferOption) TransferConfig {
+	c := TransferConfig{PartSize: partSize, Concurrency: concurrency}
+	transferDefaultsMu.RLock()
+	if transferDefaults.PartSize > 0 {
+		c.PartSize = transferDefaults.PartSize
+	}
+	if transferDefaults.Concurrency > 0 {
+		c.Concurrency = transferDefaults.Concurrency
+	}
+	c.Limiter = transferDefaults.Limiter
+	transferDefaultsMu.RUnlock()
+
+	partSize, concurrency = c.PartSize, c.Concurrency
+	for _, opt := range opts {
+		opt(&c)
+	}
+	// Options such as WithPartSize(0) keep the defaults
+	if c.PartSize <= 0 {
+		c.PartSize = partSize
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = concurrency
+	}
+	return c
+}
+
+// track starts tracking the progress of a transfer of total bytes, 0 when
+// unknown. Progress is counted by the requestOptions.
+func (c *TransferConfig) track(total int64) *progress.Tracker {
+	c.tracker = progress.NewTracker(total, c.progressInterval, c.progress)
+	return c.tracker
+}
+
+// CalculatePartSize returns the part size to upload an object of size bytes
+// with, raising partSize to the next MB when the upload would need more than
+// s3manager.MaxUploadParts parts. A partSize of 0 or less is replaced with
+// DEFAULT_PART_SIZE.
+func CalculatePartSize(size, partSize int64) int64 {
+	const mb = 1024 * 1024
+	if partSize <= 0 {
+		partSize = DEFAULT_PART_SIZE
+	}
+	if min := (size + s3manager.MaxUploadParts - 1) / s3manager.MaxUploadParts; partSize < min {
+		partSize = (min + mb - 1) / mb * mb
+	}
+	return partSize
+}
+
+func (c TransferConfig) uploader(awsSess *session.Session, size int64) *s3manager.Uploader {
+	return s3manager.NewUploader(awsSess, func(u *s3manager.Uploader) {
+		u.PartSize = c.PartSize
+		if size > 0 {
+			u.PartSize = CalculatePartSize(size, c.PartSize)
+		}
+		u.Concurrency = c.Concurrency
+		u.RequestOptions = c.requestOptions()
+	})
+}
+
+func (c TransferConfig) downloader(awsSess *session.Session) *s3manager.Downloader {
+	return s3manager.NewDownloader(awsSess, func(d *s3manager.Downloader) {
+		d.PartSize = c.PartSize
+		d.Concurrency = c.Concurrency
+		d.RequestOptions = c.requestOptions()
+	})
+}
+
+// requestOptions throttle the request and response bodies of every attempt
+// of a request when a Limiter is set, and count the object data sent and
+// received when progress is tracked.
+func (c TransferConfig) requestOptions() []request.Option {
+	if c.Limiter == nil && c.tracker == nil {
+		return nil
+	}
+	limiter, tracker := c.Limiter, c.tracker
+	return []request.Option{func(r *request.Request) {
+		// Bytes counted by an attempt, which are taken back when it is retried
+		var counted int64
+		r.Handlers.Send.PushFront(func(r *request.Request) {
+			tracker.Add(-atomic.SwapInt64(&counted, 0))
+			if r.HTTPRequest.Body == nil || r.HTTPRequest.Body == http.NoBody || r.HTTPRequest.ContentLength <= 0 {
+				return
+			}
+			body := &transferBody{ctx: r.Context(), body: r.HTTPRequest.Body, limiter: limiter}
+			if isUpload(r) {
+				body.tracker, body.counted = tracker, &counted
+			}
+			r.HTTPRequest.Body = body
+		})
+		r.Handlers.Send.PushBack(func(r *request.Request) {
+			if r.HTTPResponse == nil || r.HTTPResponse.Body == nil {
+				return
+			}
+			body := &transferBody{ctx: r.Context(), body: r.HTTPResponse.Body, limiter: limiter}
+			if r.Operation.Name == "GetObject" && r.HTTPResponse.StatusCode < 300 {
+				tracker.SetTotal(objectSize(r.HTTPResponse))
+				body.tracker, body.counted = tracker, &counted
+			}
+			r.HTTPResponse.Body = body
+		})
+	}}
+}
+
+func isUpload(r *request.Request) bool {
+	return r.Operation.Name == "PutObject" || r.Operation.Name == "UploadPart"
+}
+
+// objectSize returns the size of the whole object from a GetObject response,
+// which may only be for a range of it.
+func objectSize(resp *http.Response) int64 {
+	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+		if i := strings.LastIndex(contentRange, "/"); i >= 0 {
+			size, _ := strconv.ParseInt(contentRange[i+1:], 10, 64)
+			return size
+		}
+	}
+	return resp.ContentLength
+}
+
+// transferBody waits for the limiter, if any, before handing out the bytes
+// it read, and counts them when tracked. The bytes are taken back when the
+// body fails, as the data is sent or received again on retry.
+type transferBody struct {
+	ctx     context.Context
+	body    io.ReadCloser
+	limiter *rate.Limiter
+	tracker *progress.Tracker
+	counted *int64
+}
+
+func (b *transferBody) Read(p []byte) (int, error) {
+	if b.limiter != nil && len(p) > limiterChunk {
+		p = p[:limiterChunk]
+	}
+	n, err := b.body.Read(p)
+	if n > 0 && b.limiter != nil {
+		if werr := b.limiter.WaitN(b.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	if n > 0 && b.tracker != nil {
+		atomic.AddInt64(b.counted, int64(n))
+		b.tracker.Add(int64(n))
+	}
+	// The downloader retries parts whose body breaks off with a new request,
+	// so take back what this attempt counted
+	if err != nil && err != io.EOF && b.tracker != nil {
+		b.tracker.Add(-atomic.SwapInt64(b.counted, 0))
+	}
+	return n, err
+}
+
+func (b *transferBody) Close() error {
+	return b.body.Close()
+}
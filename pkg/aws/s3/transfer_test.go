@@ -0,0 +1,192 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dashwave/sharedlib/pkg/progress"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalculatePartSize(t *testing.T) {
+	const mb, gb = 1024 * 1024, 1024 * 1024 * 1024
+	tests := []struct {
+		size, partSize, want int64
+	}{
+		{size: 0, partSize: DEFAULT_PART_SIZE, want: DEFAULT_PART_SIZE},
+		{size: 0, partSize: 0, want: DEFAULT_PART_SIZE},
+		{size: 10 * gb, partSize: -1, want: DEFAULT_PART_SIZE},
+		{size: 10 * gb, partSize: 5 * mb, want: 5 * mb},
+		{size: 100 * gb, partSize: 5 * mb, want: 11 * mb},
+		{size: 5000 * gb, partSize: DEFAULT_PART_SIZE, want: 512 * mb},
+	}
+	for _, tt := range tests {
+		got := CalculatePartSize(tt.size, tt.partSize)
+		assert.Equal(t, tt.want, got)
+		assert.LessOrEqual(t, (tt.size+got-1)/got, int64(10000))
+	}
+}
+
+func TestTransferConfig(t *testing.T) {
+	defer SetTransferDefaults(TransferConfig{})
+
+	c := transferConfig(DEFAULT_PART_SIZE, DEFAULT_CONCURRENCY, nil)
+	assert.Equal(t, TransferConfig{PartSize: DEFAULT_PART_SIZE, Concurrency: DEFAULT_CONCURRENCY}, c)
+
+	shared := NewBandwidthLimiter(1024 * 1024)
+	SetTransferDefaults(TransferConfig{Concurrency: 2, Limiter: shared})
+	c = transferConfig(DEFAULT_PART_SIZE, DEFAULT_CONCURRENCY, nil)
+	assert.Equal(t, int64(DEFAULT_PART_SIZE), c.PartSize)
+	assert.Equal(t, 2, c.Concurrency)
+	assert.True(t, c.Limiter == shared)
+
+	c = transferConfig(DEFAULT_PART_SIZE, DEFAULT_CONCURRENCY, []TransferOption{WithPartSize(8 * 1024 * 1024), WithConcurrency(1), WithBandwidthLimit(512)})
+	assert.Equal(t, int64(8*1024*1024), c.PartSize)
+	assert.Equal(t, 1, c.Concurrency)
+	assert.False(t, c.Limiter == shared)
+
+	c = transferConfig(DEFAULT_PART_SIZE, DEFAULT_CONCURRENCY, []TransferOption{WithPartSize(0), WithConcurrency(-1)})
+	assert.Equal(t, int64(DEFAULT_PART_SIZE), c.PartSize)
+	assert.Equal(t, 2, c.Concurrency)
+}
+
+// lowerMinPartSize lets a test upload small files in parts.
+func lowerMinPartSize(t *testing.T) {
+	min := minUploadPartSize
+	minUploadPartSize = 1
+	t.Cleanup(func() { minUploadPartSize = min })
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	const limit = 128 * 1024
+	content := bytes.Repeat([]byte("x"), 2*limit)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	// The first second worth of bytes is a burst, the rest is throttled
+	start := time.Now()
+	object, err := OpenObject(context.Background(), newTestClient(server.URL), &GetObjectRequest{BucketName: "artefacts", ObjectName: "app.apk"}, WithBandwidthLimit(limit))
+	if assert.NoError(t, err) {
+		data, err := ioutil.ReadAll(object)
+		object.Close()
+		assert.NoError(t, err)
+		assert.Len(t, data, len(content))
+	}
+	assert.Greater(t, time.Since(start), 800*time.Millisecond)
+
+	lowerMinPartSize(t)
+	fake, multipart := newFakeMultipart(t)
+	source := filepath.Join(t.TempDir(), "app.apk")
+	assert.NoError(t, os.WriteFile(source, content, 0644))
+	start = time.Now()
+	assert.NoError(t, UploadResumable(context.Background(), newTestClient(multipart.URL), &ResumableUploadRequest{
+		BucketName: "artefacts",
+		ObjectName: "app.apk",
+		Source:     source,
+		PartSize:   limit / 2,
+	}, WithBandwidthLimit(limit)))
+	assert.Greater(t, time.Since(start), 800*time.Millisecond)
+	assert.True(t, bytes.Equal(content, fake.objects["app.apk"]))
+}
+
+func TestTransferProgress(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 300*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	var updates []progress.Progress
+	record := func(p progress.Progress) { updates = append(updates, p) }
+	resp, err := GetObject(newTestClient(server.URL), &GetObjectRequest{BucketName: "artefacts", ObjectName: "app.apk"}, WithProgress(record, time.Nanosecond))
+	assert.NoError(t, err)
+	assert.Len(t, resp.Body, len(content))
+	if assert.NotEmpty(t, updates) {
+		last := updates[len(updates)-1]
+		assert.True(t, last.Finished)
+		assert.Equal(t, int64(len(content)), last.Done)
+		assert.Equal(t, int64(len(content)), last.Total)
+	}
+
+	// A retried part is only counted once
+	lowerMinPartSize(t)
+	fake, multipart := newFakeMultipart(t)
+	fake.flakyPart = 2
+	source := filepath.Join(t.TempDir(), "app.apk")
+	assert.NoError(t, os.WriteFile(source, content, 0644))
+	updates = nil
+	assert.NoError(t, UploadResumable(context.Background(), newTestClient(multipart.URL), &ResumableUploadRequest{
+		BucketName:  "artefacts",
+		ObjectName:  "app.apk",
+		Source:      source,
+		PartSize:    100 * 1024,
+		Concurrency: 1,
+	}, WithProgress(record, time.Nanosecond)))
+	if assert.NotEmpty(t, updates) {
+		last := updates[len(updates)-1]
+		assert.True(t, last.Finished)
+		assert.Equal(t, int64(len(content)), last.Done)
+		assert.Equal(t, int64(len(content)), last.Total)
+	}
+	for _, p := range updates {
+		assert.LessOrEqual(t, p.Done, p.Total)
+	}
+}
+
+func TestTransferProgressDownloadRetry(t *testing.T) {
+	const partSize = 100 * 1024
+	content := bytes.Repeat([]byte("x"), 3*partSize)
+	var aborted int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt of the second part breaks off halfway through
+		if strings.HasPrefix(r.Header.Get("Range"), "bytes="+strconv.Itoa(partSize)+"-") && atomic.CompareAndSwapInt32(&aborted, 0, 1) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", partSize, 2*partSize-1, len(content)))
+			w.Header().Set("Content-Length", strconv.Itoa(partSize))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[:partSize/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "app.apk", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	var updates []progress.Progress
+	record := func(p progress.Progress) { updates = append(updates, p) }
+	destination := filepath.Join(t.TempDir(), "app.apk")
+	assert.NoError(t, GetObjectMultipart(newTestSession(server.URL), &GetMultiPartObjectRequest{
+		BucketName:  "artefacts",
+		ObjectName:  "app.apk",
+		Destination: destination,
+	}, WithPartSize(partSize), WithConcurrency(1), WithProgress(record, time.Nanosecond)))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&aborted))
+	data, err := os.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(content, data))
+
+	// The bytes of the broken attempt are only counted once
+	if assert.NotEmpty(t, updates) {
+		last := updates[len(updates)-1]
+		assert.True(t, last.Finished)
+		assert.Equal(t, int64(len(content)), last.Done)
+		assert.Equal(t, int64(len(content)), last.Total)
+	}
+	for _, p := range updates {
+		assert.LessOrEqual(t, p.Done, p.Total)
+	}
+}
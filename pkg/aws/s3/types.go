@@ -1,6 +1,9 @@
 package s3
 
-import "time"
+import (
+	"io"
+	"time"
+)
 
 type CreateBucketConfiguration struct {
 	Name                       string
@@ -52,3 +55,154 @@ type UploadMultipartObjectRequest struct {
 	ObjectName string
 	Source     string
 }
+
+type UploadStreamRequest struct {
+	BucketName  string
+	ObjectName  string
+	ContentType string
+	ACL         string
+	Metadata    map[string]string
+}
+
+// ObjectReader streams the body of an object. It must be closed.
+type ObjectReader struct {
+	io.ReadCloser
+	ContentLength int64
+	ContentType   string
+	ETag          string
+	VersionId     string
+	LastModified  time.Time
+	Metadata      map[string]string
+}
+
+type ListObjectsRequest struct {
+	BucketName string
+	Prefix     string
+	// Delimiter, usually "/", groups the keys below Prefix into "folders",
+	// which are returned once as common prefixes instead of every object
+	// under them
+	Delimiter  string
+	StartAfter string
+	// PageSize is the number of keys fetched per request, at most 1000
+	PageSize int64
+	// Pattern is matched against the whole key with path.Match, so "*" does
+	// not match across "/". Common prefixes are matched without their
+	// trailing Delimiter, e.g. "builds/2024*" matches "builds/2024-01/".
+	Pattern        string
+	MinSize        int64
+	MaxSize        int64
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+}
+
+// ObjectInfo describes an object of a listing, or a common prefix when
+// IsPrefix is set, in which case only Key is set.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+	StorageClass string
+	IsPrefix     bool
+}
+
+type DeleteObjectRequest struct {
+	BucketName string
+	ObjectName string
+	VersionId  string
+}
+
+type DeleteObjectsRequest struct {
+	BucketName string
+	Keys       []string
+	// Concurrency is the number of batches of up to MAX_DELETE_BATCH keys
+	// deleted at a time, defaults to DEFAULT_BULK_CONCURRENCY
+	Concurrency int
+	// DryRun only reports the keys that would be deleted
+	DryRun bool
+}
+
+type DeletePrefixRequest struct {
+	BucketName  string
+	Prefix      string
+	Concurrency int
+	DryRun      bool
+}
+
+type CopyObjectRequest struct {
+	SourceBucket    string
+	SourceKey       string
+	SourceVersionId string
+	BucketName      string
+	ObjectName      string
+	ACL             string
+	// Concurrency is the number of parts copied at a time for objects larger
+	// than MAX_COPY_OBJECT_SIZE, defaults to DEFAULT_BULK_CONCURRENCY
+	Concurrency int
+}
+
+type MovePrefixRequest struct {
+	SourceBucket string
+	Prefix       string
+	// BucketName defaults to SourceBucket
+	BucketName        string
+	DestinationPrefix string
+	// Concurrency is the number of objects copied at a time, defaults to
+	// DEFAULT_BULK_CONCURRENCY
+	Concurrency int
+	// DryRun only reports the objects that would be moved
+	DryRun bool
+}
+
+// ObjectError is the failure of a single key in a bulk operation.
+type ObjectError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+func (e ObjectError) Error() string {
+	return e.Key + ": " + e.Code + ": " + e.Message
+}
+
+// DeleteResult reports the keys deleted by a bulk delete, or that would be
+// deleted in a dry run, and the keys that could not be deleted.
+type DeleteResult struct {
+	Deleted []string
+	Errors  []ObjectError
+	DryRun  bool
+}
+
+type ObjectMove struct {
+	Source      string
+	Destination string
+}
+
+// MoveResult reports the objects moved by MovePrefix, or that would be moved
+// in a dry run, and the source keys that could not be moved.
+type MoveResult struct {
+	Moved  []ObjectMove
+	Errors []ObjectError
+	DryRun bool
+}
+
+type ResumableUploadRequest struct {
+	BucketName  string
+	ObjectName  string
+	Source      string
+	ContentType string
+	// Checkpoint is the file the upload state is persisted to, defaults to
+	// Source with CHECKPOINT_FILE_SUFFIX appended
+	Checkpoint string
+	// PartSize and Concurrency override the transfer options when set. S3
+	// requires parts of at least 5MB, except for the last one, so smaller
+	// part sizes are rejected unless the file fits in a single part.
+	PartSize    int64
+	Concurrency int
+}
+
+type MultipartUpload struct {
+	Key       string
+	UploadId  string
+	Initiated time.Time
+}
@@ -0,0 +1,162 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/dashwave/sharedlib/pkg/vault"
+)
+
+const (
+	VAULT_CREDENTIALS_PROVIDER_NAME = "VaultAWSSecretsEngine"
+
+	DEFAULT_AWS_SECRETS_MOUNT = "aws"
+	// defaultExpiryWindow is how long before the lease ends credentials are
+	// considered expired, so requests in flight never use expired keys.
+	defaultExpiryWindow = 5 * time.Minute
+)
+
+// VaultCredentialsRequest configures where dynamic AWS credentials are
+// requested from in the Vault AWS secrets engine.
+type VaultCredentialsRequest struct {
+	// MountPath defaults to DEFAULT_AWS_SECRETS_MOUNT
+	MountPath string
+	Role      string
+	// STS requests temporary credentials from the sts endpoint, for assumed_role
+	// and federation_token roles. Otherwise IAM user credentials are created.
+	STS bool
+	// RoleARN selects the role to assume when the Vault role allows several
+	RoleARN string
+	// TTL of the credentials, the Vault role default is used when zero
+	TTL time.Duration
+	// ExpiryWindow defaults to 5 minutes
+	ExpiryWindow time.Duration
+}
+
+// VaultCredentialsProvider is an aws-sdk credentials.Provider that requests
+// short lived credentials from the Vault AWS secrets engine. Renewable leases
+// are renewed as they approach expiry, keeping the same keys, and new
+// credentials are requested once renewal is no longer possible. Close revokes
+// the current lease.
+type VaultCredentialsProvider struct {
+	credentials.Expiry
+
+	vc  *vault.VaultClient
+	req VaultCredentialsRequest
+
+	mu    sync.Mutex
+	lease *vault.Lease
+	value credentials.Value
+}
+
+// NewVaultCredentialsProvider returns a provider for the credentials described
+// by req. No request is made until the credentials are first retrieved.
+func NewVaultCredentialsProvider(vc *vault.VaultClient, req *VaultCredentialsRequest) *VaultCredentialsProvider {
+	r := *req
+	if r.MountPath == "" {
+		r.MountPath = DEFAULT_AWS_SECRETS_MOUNT
+	}
+	if r.ExpiryWindow == 0 {
+		r.ExpiryWindow = defaultExpiryWindow
+	}
+	return &VaultCredentialsProvider{vc: vc, req: r}
+}
+
+func (p *VaultCredentialsProvider) Retrieve() (credentials.Value, error) {
+	return p.RetrieveWithContext(context.Background())
+}
+
+func (p *VaultCredentialsProvider) RetrieveWithContext(ctx credentials.Context) (credentials.Value, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.lease != nil && p.lease.Renewable {
+		err := p.vc.RenewLease(ctx, p.lease, p.req.TTL)
+		// Vault caps renewals at the max TTL, so only keep the keys while the
+		// renewed lease still outlives the expiry window
+		if err == nil && p.lease.Duration > p.req.ExpiryWindow {
+			p.SetExpiration(p.lease.ExpiresAt(), p.req.ExpiryWindow)
+			return p.value, nil
+		}
+	}
+
+	lease, err := p.issue(ctx)
+	if err != nil {
+		return credentials.Value{ProviderName: VAULT_CREDENTIALS_PROVIDER_NAME}, err
+	}
+
+	accessKeyID, _ := lease.Data["access_key"].(string)
+	secretAccessKey, _ := lease.Data["secret_key"].(string)
+	sessionToken, _ := lease.Data["security_token"].(string)
+	if accessKeyID == "" || secretAccessKey == "" {
+		return credentials.Value{ProviderName: VAULT_CREDENTIALS_PROVIDER_NAME}, fmt.Errorf("access key not found in Vault response for role %s", p.req.Role)
+	}
+
+	if p.lease != nil {
+		// Best effort, the old lease expires on its own otherwise
+		_ = p.vc.RevokeLease(ctx, p.lease.ID)
+	}
+	p.lease = lease
+	p.value = credentials.Value{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		SessionToken:    sessionToken,
+		ProviderName:    VAULT_CREDENTIALS_PROVIDER_NAME,
+	}
+	if expiresAt := lease.ExpiresAt(); !expiresAt.IsZero() {
+		p.SetExpiration(expiresAt, p.req.ExpiryWindow)
+	}
+	return p.value, nil
+}
+
+func (p *VaultCredentialsProvider) issue(ctx context.Context) (*vault.Lease, error) {
+	endpoint := "creds"
+	if p.req.STS {
+		endpoint = "sts"
+	}
+	query := url.Values{}
+	if p.req.TTL > 0 {
+		query.Set("ttl", p.req.TTL.String())
+	}
+	if p.req.RoleARN != "" {
+		query.Set("role_arn", p.req.RoleARN)
+	}
+	return p.vc.ReadLease(ctx, fmt.Sprintf("%s/%s/%s", p.req.MountPath, endpoint, p.req.Role), query)
+}
+
+// Close revokes the lease of the current credentials, invalidating them.
+func (p *VaultCredentialsProvider) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.lease == nil || p.lease.ID == "" {
+		return nil
+	}
+	if err := p.vc.RevokeLease(ctx, p.lease.ID); err != nil {
+		return err
+	}
+	p.lease = nil
+	p.SetExpiration(time.Now(), 0)
+	return nil
+}
+
+// ConnectAwsWithVaultCredentials creates an AWS session using dynamic
+// credentials from the Vault AWS secrets engine instead of static keys. The
+// returned provider should be closed on shutdown to revoke the credentials.
+func ConnectAwsWithVaultCredentials(v *vault.VaultClient, region string, req *VaultCredentialsRequest) (*session.Session, *VaultCredentialsProvider, error) {
+	provider := NewVaultCredentialsProvider(v, req)
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.NewCredentials(provider),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return sess, provider, nil
+}
@@ -0,0 +1,61 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dashwave/sharedlib/pkg/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVaultCredentialsProvider(t *testing.T) {
+	var issued, renewed, revoked int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/aws/creds/build-runner":
+			atomic.AddInt32(&issued, 1)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"lease_id":       "aws/creds/build-runner/lease",
+				"lease_duration": 3600,
+				"renewable":      true,
+				"data":           map[string]interface{}{"access_key": "AKIA", "secret_key": "secret"},
+			})
+		case "/v1/sys/leases/renew":
+			atomic.AddInt32(&renewed, 1)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"lease_id": "aws/creds/build-runner/lease", "lease_duration": 7200, "renewable": true,
+			})
+		case "/v1/sys/leases/revoke":
+			atomic.AddInt32(&revoked, 1)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	vc, err := vault.New(vault.WithAddress(server.URL), vault.WithToken("token"))
+	assert.NoError(t, err)
+	provider := NewVaultCredentialsProvider(vc, &VaultCredentialsRequest{Role: "build-runner"})
+
+	value, err := provider.Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIA", value.AccessKeyID)
+	assert.Equal(t, VAULT_CREDENTIALS_PROVIDER_NAME, value.ProviderName)
+	assert.False(t, provider.IsExpired())
+
+	// A second retrieval renews the lease instead of issuing new keys
+	value, err = provider.Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIA", value.AccessKeyID)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&issued))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&renewed))
+
+	assert.NoError(t, provider.Close(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&revoked))
+	assert.True(t, provider.IsExpired())
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
 )
 
 func Encrypt(plaintext, secretKey string) (string, error) {
@@ -35,7 +36,10 @@ func Encrypt(plaintext, secretKey string) (string, error) {
 }
 
 func Decrypt(ciphertext, secretKey string) (string, error) {
-	cipherBytes, _ := hex.DecodeString(ciphertext)
+	cipherBytes, err := hex.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode ciphertext: %v", err)
+	}
 	aes, err := aes.NewCipher([]byte(secretKey))
 	if err != nil {
 		return "", err
@@ -49,6 +53,9 @@ func Decrypt(ciphertext, secretKey string) (string, error) {
 	// Since we know the ciphertext is actually nonce+ciphertext
 	// And len(nonce) == NonceSize(). We can separate the two.
 	nonceSize := gcm.NonceSize()
+	if len(cipherBytes) < nonceSize+gcm.Overhead() {
+		return "", fmt.Errorf("ciphertext is too short")
+	}
 	nonce, cipherb := cipherBytes[:nonceSize], cipherBytes[nonceSize:]
 
 	plaintext, err := gcm.Open(nil, []byte(nonce), []byte(cipherb), nil)
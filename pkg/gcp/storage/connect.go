@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 
@@ -13,24 +15,50 @@ import (
 const (
 	US_VAULT    = "US-VAULT"
 	INDIA_VAULT = "INDIA-VAULT"
+
+	GCP_CREDENTIALS_JSON_KEY = "GCP_CREDENTIALS_JSON"
+)
+
+var (
+	// ErrAccountUnknown is matched by errors.Is when the account location is
+	// neither US_VAULT nor INDIA_VAULT.
+	ErrAccountUnknown = errors.New("unknown GCP account")
+	// ErrSecretMissing is matched by errors.Is when the secret of an account,
+	// or its GCP_CREDENTIALS_JSON key, does not exist.
+	ErrSecretMissing = errors.New("GCP credentials secret missing")
+	// ErrCredentialMalformed is matched by errors.Is when GCP_CREDENTIALS_JSON
+	// is not a JSON document.
+	ErrCredentialMalformed = errors.New("GCP credential malformed")
 )
 
-func ConnectGCP(v *vault.VaultClient, accountLocation string) (*storage.Client, vault.VaultSecretMap, error) {
+// ConnectGCP creates a storage client with the service account key of
+// accountLocation read from v, which is usually a *vault.VaultClient.
+func ConnectGCP(v vault.SecretStore, accountLocation string) (*storage.Client, vault.VaultSecretMap, error) {
 	secretPath := ""
 	if accountLocation == US_VAULT {
 		secretPath = "US-GCP-ACCOUNT"
 	} else if accountLocation == INDIA_VAULT {
 		secretPath = "INDIA-GCP-ACCOUNT"
 	} else {
-		return nil, nil, fmt.Errorf("invalid GCP account location provided : %s", accountLocation)
+		return nil, nil, fmt.Errorf("invalid GCP account location provided : %w: %s", ErrAccountUnknown, accountLocation)
 	}
 
-	secrets, err := v.GetSecretMap(secretPath)
+	secrets, err := v.GetMap(context.Background(), secretPath)
+	if errors.Is(err, vault.ErrSecretNotFound) {
+		return nil, nil, fmt.Errorf("%w: %s for account %s", ErrSecretMissing, secretPath, accountLocation)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
 
-	credentialsJSON := secrets["GCP_CREDENTIALS_JSON"].(string)
+	raw, ok := secrets[GCP_CREDENTIALS_JSON_KEY]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s not found in vault", ErrSecretMissing, GCP_CREDENTIALS_JSON_KEY)
+	}
+	credentialsJSON, ok := raw.(string)
+	if !ok || !json.Valid([]byte(credentialsJSON)) {
+		return nil, nil, fmt.Errorf("%w: %s is not a JSON document", ErrCredentialMalformed, GCP_CREDENTIALS_JSON_KEY)
+	}
 	client, err := storage.NewClient(context.Background(), option.WithCredentialsJSON([]byte(credentialsJSON)))
 	if err != nil {
 		return nil, nil, err
@@ -39,18 +67,32 @@ func ConnectGCP(v *vault.VaultClient, accountLocation string) (*storage.Client,
 	return client, secrets, nil
 }
 
+// ConnectStorage is like ConnectStorageClient but panics on failure.
+//
+// Deprecated: use ConnectStorageClient, which returns an error instead.
 func ConnectStorage() (*storage.Client, vault.VaultSecretMap) {
-	vaultClient, err := vault.NewVaultClient()
+	storageClient, secrets, err := ConnectStorageClient()
 	if err != nil {
 		panic(err)
 	}
 
+	return storageClient, secrets
+}
+
+// ConnectStorageClient creates a storage client for the India account, with
+// a Vault client created from the environment.
+func ConnectStorageClient() (*storage.Client, vault.VaultSecretMap, error) {
+	vaultClient, err := vault.NewVaultClient()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	storageClient, secrets, err := ConnectGCP(vaultClient, INDIA_VAULT)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 
-	return storageClient, secrets
+	return storageClient, secrets, nil
 }
 
 func GetGCPClient() (*storage.Client, error) {
@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dashwave/sharedlib/pkg/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectGCPErrors(t *testing.T) {
+	store := vault.NewMemoryStore(map[string]vault.VaultSecretMap{
+		"US-GCP-ACCOUNT": {GCP_CREDENTIALS_JSON_KEY: "not json"},
+	})
+
+	_, _, err := ConnectGCP(store, "EU-VAULT")
+	assert.True(t, errors.Is(err, ErrAccountUnknown))
+	_, _, err = ConnectGCP(store, INDIA_VAULT)
+	assert.True(t, errors.Is(err, ErrSecretMissing))
+	_, _, err = ConnectGCP(store, US_VAULT)
+	assert.True(t, errors.Is(err, ErrCredentialMalformed))
+}
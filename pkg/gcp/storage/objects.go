@@ -13,12 +13,15 @@ import (
 
 // UploadObjectToBucket uploads the provided object to GCS bucket. It either completely uploads the object
 // to the bucket and returns successfully or throws an error without any upload.
-func UploadObjectToBucket(client *storage.Client, object *StorageObject) error {
+// Progress can be reported with WithProgress
+func UploadObjectToBucket(client *storage.Client, object *StorageObject, opts ...TransferOption) error {
 	ctx := context.Background()
 	bucket := client.Bucket(*object.Bucket)
 	obj := bucket.Object(*object.Name)
 
 	writer := obj.NewWriter(ctx)
+	tracker := newTracker(int64(len(object.Body)), opts)
+	writer.ProgressFunc = tracker.Set
 
 	if object.ContentType != "" {
 		writer.ContentType = object.ContentType
@@ -35,6 +38,9 @@ func UploadObjectToBucket(client *storage.Client, object *StorageObject) error {
 	if err := writer.Close(); err != nil {
 		return err
 	}
+	// Uploads smaller than a chunk are sent at once, without progress
+	tracker.Set(writer.Attrs().Size)
+	tracker.Finish()
 
 	fmt.Printf("Successfully uploaded object with name %v to the bucket %v.\n", *object.Name, *object.Bucket)
 	return nil
@@ -42,7 +48,8 @@ func UploadObjectToBucket(client *storage.Client, object *StorageObject) error {
 
 // UploadObjectMultipart uploads the object data from the given source object to the bucket.
 // GCS automatically handles chunking and parallel uploads for large files.
-func UploadObjectMultipart(client *storage.Client, r *GetMultiPartObjectRequest) error {
+// Progress can be reported with WithProgress
+func UploadObjectMultipart(client *storage.Client, r *GetMultiPartObjectRequest, opts ...TransferOption) error {
 	ctx := context.Background()
 	file, err := os.Open(r.Source)
 	if err != nil {
@@ -50,24 +57,34 @@ func UploadObjectMultipart(client *storage.Client, r *GetMultiPartObjectRequest)
 		return err
 	}
 	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
 
 	bucket := client.Bucket(r.BucketName)
 	obj := bucket.Object(r.ObjectName)
 
 	writer := obj.NewWriter(ctx)
+	tracker := newTracker(info.Size(), opts)
+	writer.ProgressFunc = tracker.Set
 	if _, err := io.Copy(writer, file); err != nil {
 		return err
 	}
 	if err := writer.Close(); err != nil {
 		return err
 	}
+	// Uploads smaller than a chunk are sent at once, without progress
+	tracker.Set(writer.Attrs().Size)
+	tracker.Finish()
 
 	return nil
 }
 
 // GetObject downloads the object data for the given object name from the bucket.
 // To get an object with a specific generation, set VersioningEnabled to true and provide the generation number.
-func GetObject(client *storage.Client, r *GetObjectRequest) (*GetObjectResponse, error) {
+// Progress can be reported with WithProgress
+func GetObject(client *storage.Client, r *GetObjectRequest, opts ...TransferOption) (*GetObjectResponse, error) {
 	ctx := context.Background()
 	bucket := client.Bucket(r.BucketName)
 	obj := bucket.Object(r.ObjectName)
@@ -82,10 +99,12 @@ func GetObject(client *storage.Client, r *GetObjectRequest) (*GetObjectResponse,
 	}
 	defer reader.Close()
 
-	data, err := io.ReadAll(reader)
+	tracker := newTracker(reader.Attrs.Size, opts)
+	data, err := io.ReadAll(tracker.Reader(reader))
 	if err != nil {
 		return nil, err
 	}
+	tracker.Finish()
 
 	attrs, err := obj.Attrs(ctx)
 	if err != nil {
@@ -97,7 +116,8 @@ func GetObject(client *storage.Client, r *GetObjectRequest) (*GetObjectResponse,
 
 // GetObjectMultipart downloads the object data for the given object name from the bucket.
 // GCS automatically handles chunking and parallel downloads for large files.
-func GetObjectMultipart(client *storage.Client, r *GetMultiPartObjectRequest) error {
+// Progress can be reported with WithProgress
+func GetObjectMultipart(client *storage.Client, r *GetMultiPartObjectRequest, opts ...TransferOption) error {
 	ctx := context.Background()
 	bucket := client.Bucket(r.BucketName)
 	obj := bucket.Object(r.ObjectName)
@@ -118,9 +138,11 @@ func GetObjectMultipart(client *storage.Client, r *GetMultiPartObjectRequest) er
 	}
 	defer file.Close()
 
-	if _, err := io.Copy(file, reader); err != nil {
+	tracker := newTracker(reader.Attrs.Size, opts)
+	if _, err := io.Copy(file, tracker.Reader(reader)); err != nil {
 		return err
 	}
+	tracker.Finish()
 
 	return nil
 }
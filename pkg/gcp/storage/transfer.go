@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/dashwave/sharedlib/pkg/progress"
+)
+
+type transferConfig struct {
+	progress         progress.Func
+	progressInterval time.Duration
+}
+
+// TransferOption tunes a single upload or download.
+type TransferOption func(*transferConfig)
+
+// WithProgress reports the bytes transferred, throughput and ETA of a
+// transfer to fn, at most once per interval, or progress.DEFAULT_INTERVAL
+// when interval is 0. Use progress.Channel to receive updates on a channel.
+func WithProgress(fn progress.Func, interval time.Duration) TransferOption {
+	return func(c *transferConfig) {
+		c.progress = fn
+		c.progressInterval = interval
+	}
+}
+
+// newTracker returns the progress tracker of a transfer of total bytes, nil
+// when progress is not reported.
+func newTracker(total int64, opts []TransferOption) *progress.Tracker {
+	c := &transferConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return progress.NewTracker(total, c.progressInterval, c.progress)
+}
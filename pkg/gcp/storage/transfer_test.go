@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/dashwave/sharedlib/pkg/progress"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func TestTransferProgress(t *testing.T) {
+	content := strings.Repeat("x", 300*1024)
+	var uploaded int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body, _ := ioutil.ReadAll(r.Body)
+			uploaded = len(body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"bucket":"artefacts","name":"app.apk","size":"` + strconv.Itoa(len(content)) + `"}`))
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var last progress.Progress
+	record := progress.Func(func(p progress.Progress) { last = p })
+
+	destination := filepath.Join(t.TempDir(), "app.apk")
+	assert.NoError(t, GetObjectMultipart(client, &GetMultiPartObjectRequest{BucketName: "artefacts", ObjectName: "app.apk", Destination: destination}, WithProgress(record, 0)))
+	assert.True(t, last.Finished)
+	assert.Equal(t, int64(len(content)), last.Done)
+	assert.Equal(t, int64(len(content)), last.Total)
+
+	last = progress.Progress{}
+	assert.NoError(t, UploadObjectMultipart(client, &GetMultiPartObjectRequest{BucketName: "artefacts", ObjectName: "app.apk", Source: destination}, WithProgress(record, 0)))
+	assert.Greater(t, uploaded, len(content))
+	assert.True(t, last.Finished)
+	assert.Equal(t, int64(len(content)), last.Done)
+	assert.Equal(t, int64(len(content)), last.Total)
+
+	// Without WithProgress nothing is tracked
+	assert.Nil(t, newTracker(1, nil))
+}
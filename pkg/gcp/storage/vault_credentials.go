@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/dashwave/sharedlib/pkg/vault"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+)
+
+const (
+	DEFAULT_GCP_SECRETS_MOUNT = "gcp"
+
+	// keyRenewWindow is how long before its lease ends a service account key
+	// is replaced, so tokens are never minted from a key about to be revoked.
+	// Keys with shorter leases are replaced halfway through.
+	keyRenewWindow = 5 * time.Minute
+)
+
+// VaultCredentialsRequest configures where GCP credentials are requested
+// from in the Vault GCP secrets engine. Exactly one of Roleset and
+// StaticAccount must be set.
+type VaultCredentialsRequest struct {
+	// MountPath defaults to DEFAULT_GCP_SECRETS_MOUNT
+	MountPath     string
+	Roleset       string
+	StaticAccount string
+	// Key requests short lived service account keys and mints tokens from
+	// them locally, instead of requesting OAuth access tokens from Vault.
+	Key bool
+	// KeyTTL of the service account keys, the Vault default is used when zero
+	KeyTTL time.Duration
+	// Scopes used to mint tokens from keys, defaults to storage.ScopeFullControl
+	Scopes []string
+}
+
+// VaultTokenSource is an oauth2.TokenSource backed by the Vault GCP secrets
+// engine. Wrap it with oauth2.ReuseTokenSource to only go to Vault once the
+// current token expires. Tokens minted from a key expire when the key is due
+// to be replaced at the latest, so cached tokens never outlive their key.
+// A key revoked in Vault before then is still used until that time. Close
+// revokes the current service account key.
+type VaultTokenSource struct {
+	vc  *vault.VaultClient
+	req VaultCredentialsRequest
+
+	mu        sync.Mutex
+	lease     *vault.Lease
+	keySource oauth2.TokenSource
+}
+
+// NewVaultTokenSource returns a token source for the credentials described
+// by req. No request is made until the first token is requested.
+func NewVaultTokenSource(vc *vault.VaultClient, req *VaultCredentialsRequest) (*VaultTokenSource, error) {
+	r := *req
+	if (r.Roleset == "") == (r.StaticAccount == "") {
+		return nil, fmt.Errorf("exactly one of roleset and static account must be provided")
+	}
+	if r.MountPath == "" {
+		r.MountPath = DEFAULT_GCP_SECRETS_MOUNT
+	}
+	if len(r.Scopes) == 0 {
+		r.Scopes = []string{storage.ScopeFullControl}
+	}
+	return &VaultTokenSource{vc: vc, req: r}, nil
+}
+
+func (s *VaultTokenSource) Token() (*oauth2.Token, error) {
+	ctx := context.Background()
+	if s.req.Key {
+		return s.keyToken(ctx)
+	}
+	return s.accessToken(ctx)
+}
+
+// accessToken requests an OAuth access token straight from Vault.
+func (s *VaultTokenSource) accessToken(ctx context.Context) (*oauth2.Token, error) {
+	lease, err := s.vc.ReadLease(ctx, s.path("token"), nil)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, _ := lease.Data["token"].(string)
+	if accessToken == "" {
+		return nil, fmt.Errorf("token not found in Vault response for %s", s.path("token"))
+	}
+
+	token := &oauth2.Token{AccessToken: accessToken, TokenType: "Bearer"}
+	if expiresAt, err := strconv.ParseInt(fmt.Sprint(lease.Data["expires_at_seconds"]), 10, 64); err == nil {
+		token.Expiry = time.Unix(expiresAt, 0)
+	}
+	return token, nil
+}
+
+// keyToken mints a token from the current service account key, requesting a
+// new key from Vault once the current one approaches the end of its lease.
+func (s *VaultTokenSource) keyToken(ctx context.Context) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keySource == nil || (!keyRenewAt(s.lease).IsZero() && !time.Now().Before(keyRenewAt(s.lease))) {
+		if err := s.rotateKey(ctx); err != nil {
+			return nil, err
+		}
+	}
+	token, err := s.keySource.Token()
+	if err != nil {
+		return nil, err
+	}
+	// Tokens are cached until they expire, which must not be after the key
+	// is replaced
+	if renewAt := keyRenewAt(s.lease); !renewAt.IsZero() && (token.Expiry.IsZero() || token.Expiry.After(renewAt)) {
+		capped := *token
+		capped.Expiry = renewAt
+		return &capped, nil
+	}
+	return token, nil
+}
+
+// keyRenewAt returns when the key of lease is replaced, or zero when its
+// lease does not expire.
+func keyRenewAt(lease *vault.Lease) time.Time {
+	if lease.ExpiresAt().IsZero() {
+		return time.Time{}
+	}
+	window := keyRenewWindow
+	if lease.Duration/2 < window {
+		window = lease.Duration / 2
+	}
+	return lease.ExpiresAt().Add(-window)
+}
+
+func (s *VaultTokenSource) rotateKey(ctx context.Context) error {
+	data := map[string]interface{}{}
+	if s.req.KeyTTL > 0 {
+		data["ttl"] = s.req.KeyTTL.String()
+	}
+	lease, err := s.vc.WriteLease(ctx, s.path("key"), data)
+	if err != nil {
+		return err
+	}
+
+	encoded, _ := lease.Data["private_key_data"].(string)
+	keyJSON, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(keyJSON) == 0 {
+		return fmt.Errorf("service account key not found in Vault response for %s", s.path("key"))
+	}
+	creds, err := google.CredentialsFromJSON(ctx, keyJSON, s.req.Scopes...)
+	if err != nil {
+		return fmt.Errorf("unable to parse service account key: %v", err)
+	}
+
+	if s.lease != nil {
+		// Best effort, the old key is deleted when its lease expires otherwise
+		_ = s.vc.RevokeLease(ctx, s.lease.ID)
+	}
+	s.lease = lease
+	s.keySource = creds.TokenSource
+	return nil
+}
+
+func (s *VaultTokenSource) path(endpoint string) string {
+	if s.req.Roleset != "" {
+		return fmt.Sprintf("%s/roleset/%s/%s", s.req.MountPath, s.req.Roleset, endpoint)
+	}
+	return fmt.Sprintf("%s/static-account/%s/%s", s.req.MountPath, s.req.StaticAccount, endpoint)
+}
+
+// Close revokes the lease of the current service account key, if any.
+func (s *VaultTokenSource) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lease == nil || s.lease.ID == "" {
+		return nil
+	}
+	if err := s.vc.RevokeLease(ctx, s.lease.ID); err != nil {
+		return err
+	}
+	s.lease = nil
+	s.keySource = nil
+	return nil
+}
+
+// ConnectGCPWithVaultCredentials creates a storage client authenticated with
+// short lived credentials from the Vault GCP secrets engine instead of a
+// static service account key. The returned token source should be closed on
+// shutdown to revoke its key.
+func ConnectGCPWithVaultCredentials(v *vault.VaultClient, req *VaultCredentialsRequest) (*storage.Client, *VaultTokenSource, error) {
+	source, err := NewVaultTokenSource(v, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := storage.NewClient(context.Background(), option.WithTokenSource(oauth2.ReuseTokenSource(nil, source)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, source, nil
+}
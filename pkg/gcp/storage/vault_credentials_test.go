@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dashwave/sharedlib/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestVaultTokenSourceAccessToken(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/gcp/roleset/storage-reader/token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"token": "ya29.token", "expires_at_seconds": expiresAt, "token_ttl": 3599},
+		})
+	}))
+	defer server.Close()
+
+	vc, err := vault.New(vault.WithAddress(server.URL), vault.WithToken("token"))
+	assert.NoError(t, err)
+
+	_, err = NewVaultTokenSource(vc, &VaultCredentialsRequest{})
+	assert.Error(t, err)
+
+	source, err := NewVaultTokenSource(vc, &VaultCredentialsRequest{Roleset: "storage-reader"})
+	assert.NoError(t, err)
+	token, err := source.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "ya29.token", token.AccessToken)
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.Equal(t, expiresAt, token.Expiry.Unix())
+}
+
+// fakeGCPSecrets issues service account keys with leases of leaseDuration
+// seconds, and mints tokens from them named after the key they were minted
+// from.
+type fakeGCPSecrets struct {
+	issued, revoked int32
+}
+
+func newFakeGCPSecrets(t *testing.T, leaseDuration int) (*fakeGCPSecrets, *vault.VaultClient) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	fake := &fakeGCPSecrets{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/gcp/static-account/uploader/key":
+			key := atomic.AddInt32(&fake.issued, 1)
+			keyJSON, _ := json.Marshal(map[string]string{
+				"type":           "service_account",
+				"client_email":   "uploader@project.iam.gserviceaccount.com",
+				"private_key_id": "key-" + strconv.Itoa(int(key)),
+				"private_key":    string(privateKey),
+				"token_uri":      server.URL + "/token",
+			})
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"lease_id":       "gcp/static-account/uploader/key/lease",
+				"lease_duration": leaseDuration,
+				"data":           map[string]interface{}{"private_key_data": base64.StdEncoding.EncodeToString(keyJSON)},
+			})
+		case "/token":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "minted-" + strconv.Itoa(int(atomic.LoadInt32(&fake.issued))), "token_type": "Bearer", "expires_in": 3600,
+			})
+		case "/v1/sys/leases/revoke":
+			atomic.AddInt32(&fake.revoked, 1)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	vc, err := vault.New(vault.WithAddress(server.URL), vault.WithToken("token"))
+	assert.NoError(t, err)
+	return fake, vc
+}
+
+func TestVaultTokenSourceKey(t *testing.T) {
+	fake, vc := newFakeGCPSecrets(t, 3600)
+	source, err := NewVaultTokenSource(vc, &VaultCredentialsRequest{StaticAccount: "uploader", Key: true})
+	assert.NoError(t, err)
+
+	token, err := source.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "minted-1", token.AccessToken)
+	assert.WithinDuration(t, time.Now().Add(time.Hour-keyRenewWindow), token.Expiry, 10*time.Second)
+
+	// The key is reused while its lease is valid
+	_, err = source.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fake.issued))
+
+	assert.NoError(t, source.Close(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fake.revoked))
+}
+
+func TestVaultTokenSourceKeyRotation(t *testing.T) {
+	// Keys leased for 2s are replaced after 1s, long before the 1h tokens
+	// minted from them expire
+	fake, vc := newFakeGCPSecrets(t, 2)
+	source, err := NewVaultTokenSource(vc, &VaultCredentialsRequest{StaticAccount: "uploader", Key: true})
+	assert.NoError(t, err)
+	cached := oauth2.ReuseTokenSource(nil, source)
+
+	token, err := cached.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "minted-1", token.AccessToken)
+	token, err = cached.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "minted-1", token.AccessToken)
+
+	time.Sleep(1100 * time.Millisecond)
+	token, err = cached.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "minted-2", token.AccessToken)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fake.issued))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fake.revoked))
+}
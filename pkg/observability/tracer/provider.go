@@ -2,6 +2,7 @@ package tracer
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
@@ -64,8 +65,16 @@ func Shutdown(ctx context.Context) error {
 }
 
 func InitTracer() error {
-	insecureMode := true
+	return initTracer(otlptracegrpc.WithInsecure())
+}
+
+// InitTracerWithTLS initializes the tracer like InitTracer, but exports spans
+// over TLS with the given config, e.g. one from vault.PKI for mutual TLS.
+func InitTracerWithTLS(tlsConfig *tls.Config) error {
+	return initTracer(otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+}
 
+func initTracer(secureOption otlptracegrpc.Option) error {
 	if os.Getenv("OTEL_EXPORTER_ENDPOINT") == "" {
 		return fmt.Errorf("OTEL_EXPORTER_ENDPOINT is not set")
 	}
@@ -74,11 +83,6 @@ func InitTracer() error {
 		return fmt.Errorf("SERVICE_NAME is not set")
 	}
 
-	secureOption := otlptracegrpc.WithTLSCredentials(credentials.NewClientTLSFromCert(nil, ""))
-	if insecureMode {
-		secureOption = otlptracegrpc.WithInsecure()
-	}
-
 	exporter, err := otlptrace.New(
 		context.Background(),
 		otlptracegrpc.NewClient(
@@ -0,0 +1,204 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// DEFAULT_INTERVAL is the minimum time between two progress updates
+const DEFAULT_INTERVAL = time.Second
+
+// Progress is a snapshot of a transfer.
+type Progress struct {
+	Done int64
+	// Total is 0 while the size of the transfer is unknown
+	Total int64
+	// BytesPerSecond is the average throughput since the transfer started
+	BytesPerSecond float64
+	// ETA is 0 while the size of the transfer is unknown
+	ETA     time.Duration
+	Elapsed time.Duration
+	// Finished is set on the last update of a completed transfer
+	Finished bool
+}
+
+// Percent returns how much of the transfer is done, from 0 to 100, or 0
+// while its size is unknown.
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+	return float64(p.Done) * 100 / float64(p.Total)
+}
+
+// String formats the progress for status messages, such as
+// "42.0% (1.1 GB of 2.6 GB, 12.5 MB/s, 2m3s left)".
+func (p Progress) String() string {
+	speed := formatBytes(int64(p.BytesPerSecond)) + "/s"
+	if p.Total <= 0 {
+		return fmt.Sprintf("%s, %s", formatBytes(p.Done), speed)
+	}
+	return fmt.Sprintf("%.1f%% (%s of %s, %s, %s left)", p.Percent(), formatBytes(p.Done), formatBytes(p.Total), speed, p.ETA.Round(time.Second))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Func receives progress updates. It is called from the goroutines doing
+// the transfer, one call at a time, so it should return quickly.
+type Func func(Progress)
+
+// Channel returns a Func sending updates to ch. Updates are dropped while
+// ch is full, so a slow reader never stalls the transfer.
+func Channel(ch chan<- Progress) Func {
+	return func(p Progress) {
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
+
+// Tracker counts the bytes of a transfer and reports its progress at most
+// once per interval. All methods of a nil Tracker do nothing, so transfers
+// can track progress unconditionally.
+type Tracker struct {
+	fn       Func
+	interval time.Duration
+
+	mu       sync.Mutex
+	start    time.Time
+	last     time.Time
+	done     int64
+	total    int64
+	finished bool
+}
+
+// NewTracker returns a tracker of a transfer of total bytes, 0 when unknown,
+// reporting to fn. It returns nil when fn is nil.
+func NewTracker(total int64, interval time.Duration, fn Func) *Tracker {
+	if fn == nil {
+		return nil
+	}
+	if interval <= 0 {
+		interval = DEFAULT_INTERVAL
+	}
+	return &Tracker{fn: fn, interval: interval, start: time.Now(), total: total}
+}
+
+// Add counts n more bytes done. n may be negative when a failed attempt is
+// retried.
+func (t *Tracker) Add(n int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done += n
+	t.report(false)
+}
+
+// Set sets the bytes done, for transfers that report their own progress.
+func (t *Tracker) Set(done int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done = done
+	t.report(false)
+}
+
+// SetTotal sets the size of the transfer once it is known. Totals that are
+// not positive are ignored.
+func (t *Tracker) SetTotal(total int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.total == 0 && total > 0 {
+		t.total = total
+	}
+}
+
+// Finish reports the final progress of a completed transfer, once.
+func (t *Tracker) Finish() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.total == 0 {
+		t.total = t.done
+	}
+	t.report(true)
+}
+
+func (t *Tracker) report(finished bool) {
+	now := time.Now()
+	if t.finished || (!finished && now.Sub(t.last) < t.interval) {
+		return
+	}
+	t.last = now
+	t.finished = finished
+
+	p := Progress{Done: t.done, Total: t.total, Elapsed: now.Sub(t.start), Finished: finished}
+	if seconds := p.Elapsed.Seconds(); seconds > 0 {
+		p.BytesPerSecond = float64(p.Done) / seconds
+	}
+	if p.Total > 0 && p.BytesPerSecond > 0 && p.Done < p.Total {
+		p.ETA = time.Duration(float64(p.Total-p.Done) / p.BytesPerSecond * float64(time.Second))
+	}
+	t.fn(p)
+}
+
+// Reader counts the bytes read from r.
+func (t *Tracker) Reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &reader{r: r, t: t}
+}
+
+// Writer counts the bytes written to w.
+func (t *Tracker) Writer(w io.Writer) io.Writer {
+	if t == nil {
+		return w
+	}
+	return &writer{w: w, t: t}
+}
+
+type reader struct {
+	r io.Reader
+	t *Tracker
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.t.Add(int64(n))
+	return n, err
+}
+
+type writer struct {
+	w io.Writer
+	t *Tracker
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.t.Add(int64(n))
+	return n, err
+}
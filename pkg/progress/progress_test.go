@@ -0,0 +1,82 @@
+package progress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	var updates []Progress
+	tracker := NewTracker(1000, time.Hour, func(p Progress) { updates = append(updates, p) })
+
+	// The first update is reported, then nothing until the interval passed
+	tracker.Add(100)
+	tracker.Add(400)
+	tracker.Set(800)
+	if assert.Len(t, updates, 1) {
+		assert.Equal(t, int64(100), updates[0].Done)
+		assert.Equal(t, int64(1000), updates[0].Total)
+		assert.False(t, updates[0].Finished)
+	}
+
+	tracker.Add(200)
+	tracker.Finish()
+	tracker.Finish()
+	if assert.Len(t, updates, 2) {
+		last := updates[1]
+		assert.Equal(t, int64(1000), last.Done)
+		assert.True(t, last.Finished)
+		assert.Equal(t, float64(100), last.Percent())
+		assert.Equal(t, time.Duration(0), last.ETA)
+		assert.Greater(t, last.BytesPerSecond, float64(0))
+	}
+}
+
+func TestTrackerUnknownTotal(t *testing.T) {
+	var last Progress
+	tracker := NewTracker(0, time.Nanosecond, func(p Progress) { last = p })
+
+	n, err := io.Copy(tracker.Writer(io.Discard), tracker.Reader(strings.NewReader(strings.Repeat("x", 2048))))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2048), n)
+	// Both the reader and the writer count
+	assert.Equal(t, int64(4096), last.Done)
+	assert.Equal(t, int64(0), last.Total)
+	assert.Equal(t, float64(0), last.Percent())
+
+	tracker.SetTotal(8192)
+	tracker.Add(1)
+	assert.Equal(t, int64(8192), last.Total)
+	assert.Greater(t, last.ETA, time.Duration(0))
+}
+
+func TestNilTracker(t *testing.T) {
+	var tracker *Tracker = NewTracker(10, 0, nil)
+	assert.Nil(t, tracker)
+	tracker.Add(1)
+	tracker.SetTotal(1)
+	tracker.Finish()
+
+	var buf bytes.Buffer
+	assert.True(t, tracker.Writer(&buf) == io.Writer(&buf))
+}
+
+func TestChannel(t *testing.T) {
+	ch := make(chan Progress, 1)
+	fn := Channel(ch)
+	fn(Progress{Done: 1})
+	fn(Progress{Done: 2})
+	assert.Equal(t, int64(1), (<-ch).Done)
+	assert.Len(t, ch, 0)
+}
+
+func TestProgressString(t *testing.T) {
+	p := Progress{Done: 1536 * 1024 * 1024, Total: 3 * 1024 * 1024 * 1024, BytesPerSecond: 12.5 * 1024 * 1024, ETA: 123 * time.Second}
+	assert.Equal(t, "50.0% (1.5 GB of 3.0 GB, 12.5 MB/s, 2m3s left)", p.String())
+	assert.Equal(t, "512 B, 0 B/s", Progress{Done: 512}.String())
+}
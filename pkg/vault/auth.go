@@ -0,0 +1,272 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+const (
+	DEFAULT_KUBERNETES_TOKEN_PATH = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	// reloginRetryInterval is how long the lifecycle manager waits before
+	// retrying a failed login.
+	reloginRetryInterval = 5 * time.Second
+)
+
+// AuthMethod logs in to Vault and returns the secret holding the client token.
+// It has the same shape as the AuthMethod of the Vault API so the helpers in
+// github.com/hashicorp/vault/api/auth can be used as well.
+type AuthMethod interface {
+	Login(ctx context.Context, client *vault.Client) (*vault.Secret, error)
+}
+
+// AppRoleAuth logs in with an AppRole role_id and secret_id. The secret_id is
+// read from SecretIDPath on every login when SecretID is empty, so it can be
+// rotated on disk.
+type AppRoleAuth struct {
+	RoleID       string
+	SecretID     string
+	SecretIDPath string
+	// MountPath defaults to "approle"
+	MountPath string
+}
+
+func (a *AppRoleAuth) Login(ctx context.Context, client *vault.Client) (*vault.Secret, error) {
+	secretID, err := valueOrFile(a.SecretID, a.SecretIDPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read AppRole secret id: %v", err)
+	}
+	return login(ctx, client, mountOrDefault(a.MountPath, "approle"), map[string]interface{}{
+		"role_id":   a.RoleID,
+		"secret_id": secretID,
+	})
+}
+
+// KubernetesAuth logs in with the pod's service account JWT. The token is read
+// from TokenPath on every login since Kubernetes rotates projected tokens.
+type KubernetesAuth struct {
+	Role string
+	// TokenPath defaults to DEFAULT_KUBERNETES_TOKEN_PATH
+	TokenPath string
+	// MountPath defaults to "kubernetes"
+	MountPath string
+}
+
+func (k *KubernetesAuth) Login(ctx context.Context, client *vault.Client) (*vault.Secret, error) {
+	tokenPath := k.TokenPath
+	if tokenPath == "" {
+		tokenPath = DEFAULT_KUBERNETES_TOKEN_PATH
+	}
+	jwt, err := valueOrFile("", tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account token: %v", err)
+	}
+	return login(ctx, client, mountOrDefault(k.MountPath, "kubernetes"), map[string]interface{}{
+		"role": k.Role,
+		"jwt":  jwt,
+	})
+}
+
+// JWTAuth logs in with a JWT or OIDC id token against the jwt auth method.
+// The token is read from TokenPath on every login when Token is empty.
+type JWTAuth struct {
+	Role      string
+	Token     string
+	TokenPath string
+	// MountPath defaults to "jwt"
+	MountPath string
+}
+
+func (j *JWTAuth) Login(ctx context.Context, client *vault.Client) (*vault.Secret, error) {
+	jwt, err := valueOrFile(j.Token, j.TokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read JWT: %v", err)
+	}
+	return login(ctx, client, mountOrDefault(j.MountPath, "jwt"), map[string]interface{}{
+		"role": j.Role,
+		"jwt":  jwt,
+	})
+}
+
+func login(ctx context.Context, client *vault.Client, mountPath string, data map[string]interface{}) (*vault.Secret, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/login", mountPath), data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to log in with %s auth: %v", mountPath, err)
+	}
+	if secret == nil || secret.Auth == nil {
+		return nil, fmt.Errorf("no auth info returned by %s auth", mountPath)
+	}
+	return secret, nil
+}
+
+func mountOrDefault(mountPath, fallback string) string {
+	if mountPath == "" {
+		return fallback
+	}
+	return strings.Trim(mountPath, "/")
+}
+
+func valueOrFile(value, path string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	if path == "" {
+		return "", fmt.Errorf("neither a value nor a file path was provided")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+type RenewalEventType string
+
+const (
+	TOKEN_LOGIN          RenewalEventType = "TOKEN_LOGIN"
+	TOKEN_LOGIN_FAILED   RenewalEventType = "TOKEN_LOGIN_FAILED"
+	TOKEN_RENEWED        RenewalEventType = "TOKEN_RENEWED"
+	TOKEN_RENEWAL_FAILED RenewalEventType = "TOKEN_RENEWAL_FAILED"
+	TOKEN_EXPIRING       RenewalEventType = "TOKEN_EXPIRING"
+)
+
+// RenewalEvent describes a change in the state of the client token. TTL is the
+// lease duration of the token after the event, Err is set for failures.
+type RenewalEvent struct {
+	Type RenewalEventType
+	TTL  time.Duration
+	Err  error
+	Time time.Time
+}
+
+// Login authenticates the client with the given auth method and sets the
+// resulting token on the client.
+func (vc *VaultClient) Login(ctx context.Context, method AuthMethod) (*vault.Secret, error) {
+	secret, err := method.Login(ctx, vc.Cli)
+	if err != nil {
+		return nil, fmt.Errorf("unable to authenticate with Vault: %v", err)
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("unable to authenticate with Vault: no client token returned")
+	}
+	vc.setToken(secret.Auth.ClientToken)
+	return secret, nil
+}
+
+// setToken replaces the token of the client. Requests copy the client in
+// client, so the token is only ever replaced under tokenMu.
+func (vc *VaultClient) setToken(token string) {
+	vc.tokenMu.Lock()
+	defer vc.tokenMu.Unlock()
+	vc.Cli.SetToken(token)
+}
+
+// Close stops the background token renewal, if any.
+func (vc *VaultClient) Close() {
+	if vc.stopRenewal != nil {
+		vc.stopRenewal()
+		<-vc.renewalDone
+	}
+}
+
+// startTokenLifecycle keeps the token obtained from the auth method alive in
+// the background. It renews the token before its TTL expires and logs in
+// again once renewal fails or the token reaches its max TTL.
+func (vc *VaultClient) startTokenLifecycle(method AuthMethod, secret *vault.Secret) {
+	ctx, cancel := context.WithCancel(context.Background())
+	vc.stopRenewal = cancel
+	vc.renewalDone = make(chan struct{})
+
+	go func() {
+		defer close(vc.renewalDone)
+		for {
+			vc.watchToken(ctx, secret)
+			if ctx.Err() != nil {
+				return
+			}
+			secret = vc.relogin(ctx, method)
+			if secret == nil {
+				return
+			}
+		}
+	}()
+}
+
+// watchToken returns once the token can no longer be renewed or ctx is done.
+func (vc *VaultClient) watchToken(ctx context.Context, secret *vault.Secret) {
+	ttl := time.Duration(secret.Auth.LeaseDuration) * time.Second
+	if !secret.Auth.Renewable {
+		if ttl == 0 {
+			// The token never expires, nothing to manage
+			<-ctx.Done()
+			return
+		}
+		// Log in again once two thirds of the TTL have passed
+		select {
+		case <-ctx.Done():
+		case <-time.After(ttl * 2 / 3):
+			vc.emitRenewal(TOKEN_EXPIRING, ttl, nil)
+		}
+		return
+	}
+
+	watcher, err := vc.Cli.NewLifetimeWatcher(&vault.LifetimeWatcherInput{
+		Secret:        secret,
+		RenewBehavior: vault.RenewBehaviorErrorOnErrors,
+	})
+	if err != nil {
+		vc.emitRenewal(TOKEN_RENEWAL_FAILED, ttl, err)
+		return
+	}
+	go watcher.Start()
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-watcher.DoneCh():
+			if err != nil {
+				vc.emitRenewal(TOKEN_RENEWAL_FAILED, 0, err)
+			} else {
+				vc.emitRenewal(TOKEN_EXPIRING, 0, nil)
+			}
+			return
+		case renewal := <-watcher.RenewCh():
+			if renewal.Secret != nil && renewal.Secret.Auth != nil {
+				ttl = time.Duration(renewal.Secret.Auth.LeaseDuration) * time.Second
+			}
+			vc.emitRenewal(TOKEN_RENEWED, ttl, nil)
+		}
+	}
+}
+
+// relogin retries the login until it succeeds or ctx is done, in which case
+// it returns nil.
+func (vc *VaultClient) relogin(ctx context.Context, method AuthMethod) *vault.Secret {
+	for {
+		secret, err := vc.Login(ctx, method)
+		if err == nil {
+			vc.emitRenewal(TOKEN_LOGIN, time.Duration(secret.Auth.LeaseDuration)*time.Second, nil)
+			return secret
+		}
+		vc.emitRenewal(TOKEN_LOGIN_FAILED, 0, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(reloginRetryInterval):
+		}
+	}
+}
+
+func (vc *VaultClient) emitRenewal(eventType RenewalEventType, ttl time.Duration, err error) {
+	if vc.onRenewal == nil {
+		return
+	}
+	vc.onRenewal(RenewalEvent{Type: eventType, TTL: ttl, Err: err, Time: time.Now()})
+}
@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppRoleLoginAndRenewal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["role_id"] != "role" || body["secret_id"] != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "approle-token", "lease_duration": 3600, "renewable": true},
+			})
+		case "/v1/auth/token/renew-self":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "approle-token", "lease_duration": 7200, "renewable": true},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	events := make(chan RenewalEvent, 10)
+	vc, err := New(
+		WithAddress(server.URL),
+		WithAuth(&AppRoleAuth{RoleID: "role", SecretID: "secret"}),
+		WithRenewalCallback(func(e RenewalEvent) { events <- e }),
+	)
+	assert.NoError(t, err)
+	defer vc.Close()
+	assert.Equal(t, "approle-token", vc.Cli.Token())
+
+	for _, want := range []RenewalEventType{TOKEN_LOGIN, TOKEN_RENEWED} {
+		select {
+		case e := <-events:
+			assert.Equal(t, want, e.Type)
+			assert.NoError(t, e.Err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s event", want)
+		}
+	}
+}
+
+func TestReloginDuringRequests(t *testing.T) {
+	var logins int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			atomic.AddInt32(&logins, 1)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "approle-token", "lease_duration": 1, "renewable": false},
+			})
+		default:
+			writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"data": map[string]interface{}{"password": "hunter2"}}})
+		}
+	}))
+	defer server.Close()
+
+	vc, err := New(WithAddress(server.URL), WithAuth(&AppRoleAuth{RoleID: "role", SecretID: "secret"}))
+	assert.NoError(t, err)
+	defer vc.Close()
+
+	// Reads copy the client while the token is replaced by the relogin,
+	// which the race detector flags unless both are synchronised
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(1500 * time.Millisecond)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				_, err := vc.GetSecretCtx(context.Background(), "app", "password")
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&logins), int32(2))
+}
+
+func TestAppRoleLoginFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	_, err := New(WithAddress(server.URL), WithAuth(&AppRoleAuth{RoleID: "role", SecretID: "wrong"}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,247 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheStats holds the counters of the secret cache since the client was
+// created. Stale hits are also counted as hits.
+type CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	StaleHits     uint64
+	Refreshes     uint64
+	RefreshErrors uint64
+}
+
+// CACHE_LOAD_TIMEOUT bounds a read shared by every caller waiting for the
+// same uncached secret, since it no longer follows their contexts.
+const CACHE_LOAD_TIMEOUT = time.Minute
+
+type cacheKey struct {
+	store   string
+	path    string
+	version int
+}
+
+func (k cacheKey) String() string {
+	return fmt.Sprintf("%s/%s@%d", k.store, k.path, k.version)
+}
+
+type cacheEntry struct {
+	data       VaultSecretMap
+	fetchedAt  time.Time
+	refreshing bool
+}
+
+// secretCache caches secret reads for ttl. Entries older than ttl but younger
+// than ttl+staleTTL are still served while being refreshed in the background.
+type secretCache struct {
+	// counters are accessed atomically and kept first for 64-bit alignment
+	hits          uint64
+	misses        uint64
+	staleHits     uint64
+	refreshes     uint64
+	refreshErrors uint64
+
+	ttl      time.Duration
+	staleTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+	group   singleflight.Group
+	// generation is bumped by every invalidation
+	generation   uint64
+	lastEviction time.Time
+}
+
+func newSecretCache(ttl, staleTTL time.Duration) *secretCache {
+	return &secretCache{
+		ttl:      ttl,
+		staleTTL: staleTTL,
+		entries:  map[cacheKey]*cacheEntry{},
+	}
+}
+
+// get returns the cached secret for key, calling fetch when it is missing or
+// expired. Concurrent fetches of the same key are de-duplicated.
+func (c *secretCache) get(ctx context.Context, key cacheKey, fetch func(context.Context) (VaultSecretMap, error)) (VaultSecretMap, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		age := time.Since(entry.fetchedAt)
+		switch {
+		case age < c.ttl:
+			c.mu.Unlock()
+			atomic.AddUint64(&c.hits, 1)
+			return copySecretMap(entry.data), nil
+		case age < c.ttl+c.staleTTL:
+			if !entry.refreshing {
+				entry.refreshing = true
+				go c.refresh(key, fetch)
+			}
+			c.mu.Unlock()
+			atomic.AddUint64(&c.hits, 1)
+			atomic.AddUint64(&c.staleHits, 1)
+			return copySecretMap(entry.data), nil
+		}
+	}
+	c.mu.Unlock()
+
+	atomic.AddUint64(&c.misses, 1)
+	data, err := c.load(ctx, key, fetch)
+	if err != nil {
+		return nil, err
+	}
+	return copySecretMap(data), nil
+}
+
+// load fetches key once for every concurrent caller. The fetch is shared, so
+// it runs detached from the context of the caller that started it, and each
+// caller only stops waiting when its own ctx is done.
+func (c *secretCache) load(ctx context.Context, key cacheKey, fetch func(context.Context) (VaultSecretMap, error)) (VaultSecretMap, error) {
+	c.mu.Lock()
+	generation := c.generation
+	c.mu.Unlock()
+
+	// Loads started before an invalidation are not joined by later reads
+	ch := c.group.DoChan(fmt.Sprintf("%s#%d", key, generation), func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(detach(ctx), CACHE_LOAD_TIMEOUT)
+		defer cancel()
+		data, err := fetch(fetchCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// A secret invalidated while it was loading may have been written
+		// since, so the loaded data is not cached
+		if c.generation == generation {
+			c.entries[key] = &cacheEntry{data: data, fetchedAt: now}
+		}
+		c.evictExpired(now)
+		return data, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(VaultSecretMap), nil
+	}
+}
+
+// evictExpired drops the entries too old to be served, at most once per ttl.
+// It must be called with mu held.
+func (c *secretCache) evictExpired(now time.Time) {
+	if now.Sub(c.lastEviction) < c.ttl {
+		return
+	}
+	c.lastEviction = now
+	for key, entry := range c.entries {
+		if now.Sub(entry.fetchedAt) >= c.ttl+c.staleTTL {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// refresh reloads key in the background. On failure the stale entry is kept
+// until it expires so a later read can try again.
+func (c *secretCache) refresh(key cacheKey, fetch func(context.Context) (VaultSecretMap, error)) {
+	atomic.AddUint64(&c.refreshes, 1)
+	if _, err := c.load(context.Background(), key, fetch); err != nil {
+		atomic.AddUint64(&c.refreshErrors, 1)
+		c.mu.Lock()
+		if entry, ok := c.entries[key]; ok {
+			entry.refreshing = false
+		}
+		c.mu.Unlock()
+	}
+}
+
+// invalidate drops every cached version of the secret at path in store.
+func (c *secretCache) invalidate(store, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for key := range c.entries {
+		if key.store == store && key.path == path {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *secretCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries = map[cacheKey]*cacheEntry{}
+}
+
+func (c *secretCache) stats() CacheStats {
+	return CacheStats{
+		Hits:          atomic.LoadUint64(&c.hits),
+		Misses:        atomic.LoadUint64(&c.misses),
+		StaleHits:     atomic.LoadUint64(&c.staleHits),
+		Refreshes:     atomic.LoadUint64(&c.refreshes),
+		RefreshErrors: atomic.LoadUint64(&c.refreshErrors),
+	}
+}
+
+// detachedContext keeps the values of a context, such as its trace span, but
+// is never cancelled.
+type detachedContext struct {
+	context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// copySecretMap returns a shallow copy so callers cannot modify cached data.
+func copySecretMap(data VaultSecretMap) VaultSecretMap {
+	out := make(VaultSecretMap, len(data))
+	for k, v := range data {
+		out[k] = v
+	}
+	return out
+}
+
+// InvalidateSecret drops every cached version of the secret at secretPath in
+// kvStore, so the next read goes to Vault. It is a no-op without a cache.
+func (vc *VaultClient) InvalidateSecret(kvStore, secretPath string) {
+	if vc.cache != nil {
+		vc.cache.invalidate(kvStore, secretPath)
+	}
+}
+
+// InvalidateCache drops every cached secret. It is a no-op without a cache.
+func (vc *VaultClient) InvalidateCache() {
+	if vc.cache != nil {
+		vc.cache.invalidateAll()
+	}
+}
+
+// CacheStats returns the hit and miss counters of the secret cache. It returns
+// zero counters when the client was created without WithCache.
+func (vc *VaultClient) CacheStats() CacheStats {
+	if vc.cache == nil {
+		return CacheStats{}
+	}
+	return vc.cache.stats()
+}
@@ -0,0 +1,156 @@
+package vault
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretCache(t *testing.T) {
+	kv, vc := newFakeKV(t)
+	vc.cache = newSecretCache(time.Hour, 0)
+	kv.put(INTERNAL_SERVICES_STORE, BUILD_RUNNER_SECRET_PATH, map[string]interface{}{BR_ACCESS_ENCRYPTION_KEY: "v1"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := vc.GetSecretByStore(BUILD_RUNNER_SECRET_PATH, BR_ACCESS_ENCRYPTION_KEY, INTERNAL_SERVICES_STORE)
+			assert.NoError(t, err)
+			assert.Equal(t, "v1", value)
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, atomic.LoadInt64(&kv.reads), int64(10))
+
+	reads := atomic.LoadInt64(&kv.reads)
+	_, err := vc.GetSecretMapByStore(BUILD_RUNNER_SECRET_PATH, INTERNAL_SERVICES_STORE)
+	assert.NoError(t, err)
+	assert.Equal(t, reads, atomic.LoadInt64(&kv.reads))
+
+	kv.put(INTERNAL_SERVICES_STORE, BUILD_RUNNER_SECRET_PATH, map[string]interface{}{BR_ACCESS_ENCRYPTION_KEY: "v2"})
+	vc.InvalidateSecret(INTERNAL_SERVICES_STORE, BUILD_RUNNER_SECRET_PATH)
+	value, err := vc.GetSecretByStore(BUILD_RUNNER_SECRET_PATH, BR_ACCESS_ENCRYPTION_KEY, INTERNAL_SERVICES_STORE)
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", value)
+
+	stats := vc.CacheStats()
+	assert.Equal(t, uint64(12), stats.Hits+stats.Misses)
+	assert.GreaterOrEqual(t, stats.Hits, uint64(1))
+}
+
+func TestSecretCacheStaleWhileRevalidate(t *testing.T) {
+	kv, vc := newFakeKV(t)
+	vc.cache = newSecretCache(time.Millisecond, time.Hour)
+	kv.put(INTERNAL_SERVICES_STORE, BUILD_RUNNER_SECRET_PATH, map[string]interface{}{BR_ACCESS_ENCRYPTION_KEY: "v1"})
+
+	_, err := vc.GetSecretMapByStore(BUILD_RUNNER_SECRET_PATH, INTERNAL_SERVICES_STORE)
+	assert.NoError(t, err)
+
+	kv.put(INTERNAL_SERVICES_STORE, BUILD_RUNNER_SECRET_PATH, map[string]interface{}{BR_ACCESS_ENCRYPTION_KEY: "v2"})
+	time.Sleep(5 * time.Millisecond)
+
+	// The stale value is served while the refresh runs in the background
+	value, err := vc.GetSecretByStore(BUILD_RUNNER_SECRET_PATH, BR_ACCESS_ENCRYPTION_KEY, INTERNAL_SERVICES_STORE)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", value)
+
+	assert.Eventually(t, func() bool {
+		return vc.CacheStats().Refreshes == 1 && atomic.LoadInt64(&kv.reads) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, uint64(1), vc.CacheStats().StaleHits)
+}
+
+func TestSecretCacheSharedLoad(t *testing.T) {
+	c := newSecretCache(time.Hour, 0)
+	key := cacheKey{store: INTERNAL_SERVICES_STORE, path: BUILD_RUNNER_SECRET_PATH}
+	started, release := make(chan struct{}), make(chan struct{})
+	var fetches, cancelled int32
+	fetch := func(ctx context.Context) (VaultSecretMap, error) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			close(started)
+		}
+		select {
+		case <-release:
+		case <-ctx.Done():
+			atomic.AddInt32(&cancelled, 1)
+			return nil, ctx.Err()
+		}
+		return VaultSecretMap{"value": "v1"}, nil
+	}
+
+	// The caller that started the load gives up, the other one still gets
+	// the secret
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := c.get(ctx, key, fetch)
+		first <- err
+	}()
+	<-started
+	second := make(chan VaultSecretMap)
+	go func() {
+		data, err := c.get(context.Background(), key, fetch)
+		assert.NoError(t, err)
+		second <- data
+	}()
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+	close(release)
+	assert.Equal(t, VaultSecretMap{"value": "v1"}, <-second)
+	assert.Zero(t, atomic.LoadInt32(&cancelled))
+}
+
+func TestSecretCacheInvalidateDuringLoad(t *testing.T) {
+	c := newSecretCache(time.Hour, 0)
+	key := cacheKey{store: INTERNAL_SERVICES_STORE, path: BUILD_RUNNER_SECRET_PATH}
+	started, release := make(chan struct{}), make(chan struct{})
+	stale := make(chan VaultSecretMap)
+	go func() {
+		data, _ := c.get(context.Background(), key, func(context.Context) (VaultSecretMap, error) {
+			close(started)
+			<-release
+			return VaultSecretMap{"value": "v1"}, nil
+		})
+		stale <- data
+	}()
+	<-started
+
+	// The secret is written and invalidated while v1 is still loading
+	c.invalidate(key.store, key.path)
+	fresh := func(context.Context) (VaultSecretMap, error) {
+		return VaultSecretMap{"value": "v2"}, nil
+	}
+	data, err := c.get(context.Background(), key, fresh)
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", data["value"])
+
+	close(release)
+	assert.Equal(t, "v1", (<-stale)["value"])
+	data, err = c.get(context.Background(), key, fresh)
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", data["value"])
+}
+
+func TestSecretCacheEviction(t *testing.T) {
+	c := newSecretCache(time.Millisecond, time.Millisecond)
+	fetch := func(context.Context) (VaultSecretMap, error) {
+		return VaultSecretMap{"value": "v1"}, nil
+	}
+	for _, path := range []string{"a", "b", "c"} {
+		_, err := c.get(context.Background(), cacheKey{store: INTERNAL_SERVICES_STORE, path: path}, fetch)
+		assert.NoError(t, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	_, err := c.get(context.Background(), cacheKey{store: INTERNAL_SERVICES_STORE, path: "d"}, fetch)
+	assert.NoError(t, err)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.Len(t, c.entries, 1)
+}
@@ -2,106 +2,215 @@ package vault
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	vault "github.com/hashicorp/vault/api"
 )
 
 type VaultClient struct {
+	// Cli is the underlying Vault client. Its token is replaced in the
+	// background when WithAuth is used, so call Login rather than
+	// Cli.SetToken to change it.
 	Cli *vault.Client
+
+	tokenMu sync.RWMutex
+
+	onRenewal   func(RenewalEvent)
+	stopRenewal context.CancelFunc
+	renewalDone chan struct{}
+
+	cache *secretCache
 }
 
 type VaultSecretMap map[string]interface{}
 
-func NewVaultClient() (*VaultClient, error) {
+// New creates a VaultClient configured through the given options. Anything not
+// set explicitly falls back to the standard Vault environment variables
+// (VAULT_ADDR, VAULT_NAMESPACE, VAULT_CACERT, VAULT_TOKEN, ...), and the
+// address falls back to DEFAULT_VAULT_ADDRESS when VAULT_ADDR is not set.
+func New(opts ...Option) (*VaultClient, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	config := vault.DefaultConfig()
+	if config.Error != nil {
+		return nil, fmt.Errorf("unable to read Vault configuration: %v", config.Error)
+	}
 
-	config.Address = "https://vault.dashwave.io"
+	if os.Getenv(vault.EnvVaultAddress) == "" {
+		config.Address = DEFAULT_VAULT_ADDRESS
+	}
+	if o.address != "" {
+		config.Address = o.address
+	}
+	if o.timeout > 0 {
+		config.Timeout = o.timeout
+	}
+	if o.maxRetries != nil {
+		config.MaxRetries = *o.maxRetries
+	}
+	if o.minRetryWait > 0 {
+		config.MinRetryWait = o.minRetryWait
+	}
+	if o.maxRetryWait > 0 {
+		config.MaxRetryWait = o.maxRetryWait
+	}
+	if o.tls != nil {
+		if err := config.ConfigureTLS(o.tls); err != nil {
+			return nil, fmt.Errorf("unable to configure Vault TLS: %v", err)
+		}
+	}
 
 	client, err := vault.NewClient(config)
 	if err != nil {
 		return nil, fmt.Errorf("unable to initialize Vault client: %v", err)
 	}
 
-	// Authenticate
-	client.SetToken(os.Getenv("VAULT_TOKEN"))
+	if o.namespace != "" {
+		client.SetNamespace(o.namespace)
+	}
 
-	return &VaultClient{Cli: client}, nil
-}
+	// Authenticate, the client already picked up VAULT_TOKEN if it is set
+	switch {
+	case o.tokenSource != nil:
+		token, err := o.tokenSource()
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch Vault token: %v", err)
+		}
+		client.SetToken(token)
+	case o.token != nil:
+		client.SetToken(*o.token)
+	}
 
-func GetVaultClientByToken(accessToken string) (*VaultClient, error) {
-	config := vault.DefaultConfig()
+	vc := &VaultClient{Cli: client, onRenewal: o.onRenewal}
+	if o.cacheTTL > 0 {
+		vc.cache = newSecretCache(o.cacheTTL, o.cacheStale)
+	}
+	if o.auth != nil {
+		secret, err := vc.Login(context.Background(), o.auth)
+		if err != nil {
+			return nil, err
+		}
+		vc.emitRenewal(TOKEN_LOGIN, time.Duration(secret.Auth.LeaseDuration)*time.Second, nil)
+		vc.startTokenLifecycle(o.auth, secret)
+	}
 
-	config.Address = "https://vault.dashwave.io"
+	return vc, nil
+}
 
-	client, err := vault.NewClient(config)
-	if err != nil {
-		return nil, fmt.Errorf("unable to initialize Vault client: %v", err)
-	}
+// NewVaultClient creates a VaultClient from the environment, authenticating
+// with VAULT_TOKEN.
+func NewVaultClient() (*VaultClient, error) {
+	return New()
+}
 
+// GetVaultClientByToken creates a VaultClient from the environment,
+// authenticating with the given access token. VAULT_TOKEN is never used, even
+// when accessToken is empty.
+func GetVaultClientByToken(accessToken string) (*VaultClient, error) {
 	// Set token with required permissions set
-	client.SetToken(accessToken)
-
-	return &VaultClient{Cli: client}, nil
+	return New(WithToken(accessToken))
 }
 
 func (vc *VaultClient) GetSecret(secretPath, secretKey string) (string, error) {
-	// Read a secret from the default mount path for KV v2 in dev mode, "secret"
-	secret, err := vc.Cli.KVv2("kv-v2").Get(context.Background(), secretPath)
-	if err != nil {
-		return "", fmt.Errorf("unable to read secret: %v", err)
-	}
-
-	value, ok := secret.Data[secretKey].(string)
-	if !ok {
-		return "", fmt.Errorf("value type assertion failed: %T %#v", secret.Data[secretKey], secret.Data[secretKey])
-	}
-
-	return value, nil
+	return vc.GetSecretCtx(context.Background(), secretPath, secretKey)
 }
 
 func (vc *VaultClient) GetSecretMap(secretPath string) (VaultSecretMap, error) {
-	// Read a secret from the default mount path for KV v2 in dev mode, "secret"
-	secret, err := vc.Cli.KVv2("kv-v2").Get(context.Background(), secretPath)
-	if err != nil {
-		return VaultSecretMap{}, fmt.Errorf("unable to read secret: %v", err)
-	}
-	return secret.Data, nil
+	return vc.GetSecretMapCtx(context.Background(), secretPath)
 }
 
 func (vc *VaultClient) PutSecret(secretpath, secretKey, secretValue string) error {
-	secretData := map[string]interface{}{
-		secretKey: secretValue,
-	}
+	return vc.PutSecretCtx(context.Background(), secretpath, secretKey, secretValue)
+}
 
-	// Write a secret
-	_, err := vc.Cli.KVv2("kv-v2").Put(context.Background(), secretpath, secretData)
-	if err != nil {
-		return fmt.Errorf("unable to write secret: %v", err)
+func (vc *VaultClient) GetSecretByStore(secretPath, secretKey, kvStore string) (string, error) {
+	return vc.GetSecretByStoreCtx(context.Background(), secretPath, secretKey, kvStore)
+}
+
+func (vc *VaultClient) GetSecretMapByStore(secretPath, kvStore string) (VaultSecretMap, error) {
+	return vc.GetSecretMapByStoreCtx(context.Background(), secretPath, kvStore)
+}
+
+// GetSecretCtx reads a single key of the secret at secretPath in the default
+// KV store. The request is cancelled when ctx is done.
+func (vc *VaultClient) GetSecretCtx(ctx context.Context, secretPath, secretKey string) (string, error) {
+	return vc.GetSecretByStoreCtx(ctx, secretPath, secretKey, DEFAULT_KV_STORE)
+}
+
+// GetSecretMapCtx reads every key of the secret at secretPath in the default
+// KV store. The request is cancelled when ctx is done.
+func (vc *VaultClient) GetSecretMapCtx(ctx context.Context, secretPath string) (VaultSecretMap, error) {
+	return vc.GetSecretMapByStoreCtx(ctx, secretPath, DEFAULT_KV_STORE)
+}
+
+// PutSecretCtx writes a single key to the secret at secretpath in the default
+// KV store, replacing every other key stored there. The request is cancelled
+// when ctx is done.
+func (vc *VaultClient) PutSecretCtx(ctx context.Context, secretpath, secretKey, secretValue string) error {
+	secretData := VaultSecretMap{
+		secretKey: secretValue,
 	}
 
-	return nil
+	_, err := vc.PutSecretMap(ctx, DEFAULT_KV_STORE, secretpath, secretData)
+	return err
 }
 
-func (vc *VaultClient) GetSecretByStore(secretPath, secretKey, kvStore string) (string, error) {
-	secret, err := vc.Cli.KVv2(kvStore).Get(context.Background(), secretPath)
+// GetSecretByStoreCtx reads a single key of the secret at secretPath in the
+// given KV store. The request is cancelled when ctx is done.
+func (vc *VaultClient) GetSecretByStoreCtx(ctx context.Context, secretPath, secretKey, kvStore string) (string, error) {
+	secret, err := vc.readSecret(ctx, kvStore, secretPath)
 	if err != nil {
-		return "", fmt.Errorf("unable to read secret: %v", err)
+		return "", err
 	}
 
-	value, ok := secret.Data[secretKey].(string)
+	value, ok := secret[secretKey].(string)
 	if !ok {
-		return "", fmt.Errorf("value type assertion failed: %T %#v", secret.Data[secretKey], secret.Data[secretKey])
+		return "", fmt.Errorf("value type assertion failed: %T %#v", secret[secretKey], secret[secretKey])
 	}
 
 	return value, nil
 }
 
-func (vc *VaultClient) GetSecretMapByStore(secretPath, kvStore string) (VaultSecretMap, error) {
-	secret, err := vc.Cli.KVv2(kvStore).Get(context.Background(), secretPath)
+// GetSecretMapByStoreCtx reads every key of the secret at secretPath in the
+// given KV store. The request is cancelled when ctx is done.
+func (vc *VaultClient) GetSecretMapByStoreCtx(ctx context.Context, secretPath, kvStore string) (VaultSecretMap, error) {
+	secret, err := vc.readSecret(ctx, kvStore, secretPath)
+	if err != nil {
+		return VaultSecretMap{}, err
+	}
+	return secret, nil
+}
+
+// readSecret reads the latest version of the secret at secretPath in kvStore,
+// going through the cache when one is configured.
+func (vc *VaultClient) readSecret(ctx context.Context, kvStore, secretPath string) (VaultSecretMap, error) {
+	fetch := func(ctx context.Context) (VaultSecretMap, error) {
+		return vc.fetchSecret(ctx, kvStore, secretPath)
+	}
+	if vc.cache != nil {
+		return vc.cache.get(ctx, cacheKey{store: kvStore, path: secretPath}, fetch)
+	}
+	return fetch(ctx)
+}
+
+func (vc *VaultClient) fetchSecret(ctx context.Context, kvStore, secretPath string) (VaultSecretMap, error) {
+	ctx, span := startSpan(ctx, "vault.GetSecret", kvStore, secretPath)
+	defer span.End()
+
+	secret, err := vc.client(ctx).KVv2(kvStore).Get(ctx, secretPath)
+	if errors.Is(err, vault.ErrSecretNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, secretPath)
+	}
 	if err != nil {
-		return VaultSecretMap{}, fmt.Errorf("unable to read secret: %v", err)
+		span.RecordError(err)
+		return nil, fmt.Errorf("unable to read secret: %v", err)
 	}
 	return secret.Data, nil
 }
@@ -0,0 +1,68 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDefaults(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "env-token")
+
+	vc, err := New()
+	assert.NoError(t, err)
+	assert.Equal(t, DEFAULT_VAULT_ADDRESS, vc.Cli.Address())
+	assert.Equal(t, "env-token", vc.Cli.Token())
+}
+
+func TestNewWithOptions(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "http://127.0.0.1:8200")
+	t.Setenv("VAULT_TOKEN", "env-token")
+
+	vc, err := New(
+		WithAddress("http://vault.local:8200"),
+		WithNamespace("staging"),
+		WithTimeout(5*time.Second),
+		WithRetry(0, 0, 0),
+		WithToken("static-token"),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://vault.local:8200", vc.Cli.Address())
+	assert.Equal(t, "staging", vc.Cli.Namespace())
+	assert.Equal(t, "static-token", vc.Cli.Token())
+
+	vc, err = New(WithTokenSource(func() (string, error) { return "sourced-token", nil }))
+	assert.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8200", vc.Cli.Address())
+	assert.Equal(t, "sourced-token", vc.Cli.Token())
+
+	// An empty token never falls back to VAULT_TOKEN
+	vc, err = GetVaultClientByToken("")
+	assert.NoError(t, err)
+	assert.Empty(t, vc.Cli.Token())
+}
+
+func TestGetSecretCtxCancellation(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	vc, err := New(WithAddress(server.URL), WithToken("token"), WithRetry(0, 0, 0))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = vc.GetSecretMapByStoreCtx(ctx, "BUILD_RUNNER", INTERNAL_SERVICES_STORE)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
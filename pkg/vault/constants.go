@@ -1,6 +1,9 @@
 package vault
 
 const (
+	DEFAULT_VAULT_ADDRESS = "https://vault.dashwave.io"
+	DEFAULT_KV_STORE      = "kv-v2"
+
 	INTERNAL_SERVICES_STORE  = "internal-services"
 	BUILD_RUNNER_SECRET_PATH = "BUILD_RUNNER"
 	BR_ACCESS_ENCRYPTION_KEY = "ACCESS_ENCRYPTION_KEY"
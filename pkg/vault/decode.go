@@ -0,0 +1,325 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSecretKeyMissing is matched by errors.Is when a required key is not
+// present in a decoded secret.
+var ErrSecretKeyMissing = errors.New("secret key missing")
+
+// ErrSecretValueMalformed is matched by errors.Is when a key cannot be
+// converted to the type of the field it is decoded into.
+var ErrSecretValueMalformed = errors.New("secret value malformed")
+
+// FieldError describes why a single struct field could not be decoded.
+type FieldError struct {
+	Field string
+	Key   string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.Key, e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError aggregates every field that could not be decoded.
+type DecodeError struct {
+	Fields []*FieldError
+}
+
+func (e *DecodeError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return fmt.Sprintf("unable to decode secret: %s", strings.Join(msgs, "; "))
+}
+
+// Is reports whether any of the field errors matches target.
+func (e *DecodeError) Is(target error) bool {
+	for _, f := range e.Fields {
+		if errors.Is(f, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSecretInto reads the secret at secretPath in kvStore and decodes it into
+// dst, which must be a pointer to a struct. See DecodeSecretMap for the
+// supported tags.
+func (vc *VaultClient) GetSecretInto(ctx context.Context, kvStore, secretPath string, dst interface{}) error {
+	secret, err := vc.readSecret(ctx, kvStore, secretPath)
+	if err != nil {
+		return err
+	}
+	return DecodeSecretMap(secret, dst)
+}
+
+// DecodeSecretMap decodes secret into dst, which must be a pointer to a
+// struct. Fields are mapped with the `vault:"KEY[,options]"` tag, untagged
+// fields and fields tagged "-" are skipped. Fields are required unless tagged
+// "optional" or given a default with "default=VALUE", which must be the last
+// option and is taken verbatim.
+//
+// Strings, bools, ints, uints and floats are converted from either their JSON
+// or their string form. time.Duration accepts a duration string or a number of
+// seconds. []byte takes the raw string unless tagged "base64". Structs, maps
+// and slices are decoded from a JSON document, either stored as a string or
+// as a nested object. Pointers are allocated and decoded like the type they
+// point to, and interface{} fields take the value as stored. The fields of
+// untagged embedded structs are decoded as if declared in dst.
+//
+// Every missing or malformed field is reported in a single *DecodeError.
+func DecodeSecretMap(secret VaultSecretMap, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("decode destination must be a non-nil pointer to a struct, got %T", dst)
+	}
+
+	decodeErr := &DecodeError{}
+	decodeStruct(secret, rv.Elem(), decodeErr)
+	if len(decodeErr.Fields) > 0 {
+		return decodeErr
+	}
+	return nil
+}
+
+// decodeStruct decodes the tagged fields of rv, walking untagged embedded
+// structs as if their fields were declared in rv. Embedded pointers are
+// allocated, except to unexported types which reflect cannot set.
+func decodeStruct(secret VaultSecretMap, rv reflect.Value, decodeErr *DecodeError) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag, ok := field.Tag.Lookup("vault")
+		if !ok && field.Anonymous {
+			switch {
+			case field.Type.Kind() == reflect.Struct:
+				decodeStruct(secret, rv.Field(i), decodeErr)
+			case field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct && field.PkgPath == "":
+				if rv.Field(i).IsNil() {
+					rv.Field(i).Set(reflect.New(field.Type.Elem()))
+				}
+				decodeStruct(secret, rv.Field(i).Elem(), decodeErr)
+			}
+			continue
+		}
+		if !ok || tag == "-" || field.PkgPath != "" {
+			continue
+		}
+		key, opts := parseTag(tag)
+
+		raw, present := secret[key]
+		if !present || raw == nil {
+			switch {
+			case opts.hasDefault:
+				raw = opts.defaultValue
+			case opts.optional:
+				continue
+			default:
+				decodeErr.Fields = append(decodeErr.Fields, &FieldError{Field: field.Name, Key: key, Err: ErrSecretKeyMissing})
+				continue
+			}
+		}
+
+		if err := setField(rv.Field(i), raw, opts); err != nil {
+			decodeErr.Fields = append(decodeErr.Fields, &FieldError{
+				Field: field.Name,
+				Key:   key,
+				Err:   fmt.Errorf("%w: %v", ErrSecretValueMalformed, err),
+			})
+		}
+	}
+}
+
+type tagOptions struct {
+	optional     bool
+	base64       bool
+	hasDefault   bool
+	defaultValue string
+}
+
+func parseTag(tag string) (string, tagOptions) {
+	var opts tagOptions
+	key := tag
+	if idx := strings.Index(tag, ","); idx >= 0 {
+		key = tag[:idx]
+		rest := tag[idx+1:]
+		for rest != "" {
+			if strings.HasPrefix(rest, "default=") {
+				opts.hasDefault = true
+				opts.defaultValue = strings.TrimPrefix(rest, "default=")
+				break
+			}
+			opt := rest
+			if idx := strings.Index(rest, ","); idx >= 0 {
+				opt, rest = rest[:idx], rest[idx+1:]
+			} else {
+				rest = ""
+			}
+			switch opt {
+			case "optional":
+				opts.optional = true
+			case "base64":
+				opts.base64 = true
+			}
+		}
+	}
+	return key, opts
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setField(v reflect.Value, raw interface{}, opts tagOptions) error {
+	if v.Type() == durationType {
+		d, err := toDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		s, err := toString(raw)
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		s, err := toString(raw)
+		if err != nil {
+			return err
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s, err := toString(raw)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s, err := toString(raw)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		s, err := toString(raw)
+		if err != nil {
+			return err
+		}
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if s, ok := raw.(string); ok {
+				if !opts.base64 {
+					v.SetBytes([]byte(s))
+					return nil
+				}
+				b, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return err
+				}
+				v.SetBytes(b)
+				return nil
+			}
+		}
+		return decodeJSON(v, raw)
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := setField(elem.Elem(), raw, opts); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Interface:
+		// Empty interfaces take the value as stored, anything else has to
+		// be decoded from JSON
+		if v.NumMethod() == 0 {
+			v.Set(reflect.ValueOf(raw))
+			return nil
+		}
+		return decodeJSON(v, raw)
+	case reflect.Map, reflect.Struct:
+		return decodeJSON(v, raw)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// decodeJSON decodes raw into v, where raw is either a JSON document stored
+// as a string or a value Vault already decoded from JSON.
+func decodeJSON(v reflect.Value, raw interface{}) error {
+	var data []byte
+	if s, ok := raw.(string); ok {
+		data = []byte(s)
+	} else {
+		var err error
+		if data, err = json.Marshal(raw); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v.Addr().Interface())
+}
+
+func toString(raw interface{}) (string, error) {
+	switch val := raw.(type) {
+	case string:
+		return val, nil
+	case json.Number:
+		return val.String(), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(val), nil
+	case int64:
+		return strconv.FormatInt(val, 10), nil
+	default:
+		return "", fmt.Errorf("unexpected value type %T", raw)
+	}
+}
+
+func toDuration(raw interface{}) (time.Duration, error) {
+	s, err := toString(raw)
+	if err != nil {
+		return 0, err
+	}
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,129 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type buildRunnerSecrets struct {
+	EncryptionKey []byte            `vault:"ACCESS_ENCRYPTION_KEY,base64"`
+	VPNPassword   string            `vault:"VPN_SERVER_PASSWORD"`
+	MaxJobs       int               `vault:"MAX_JOBS,default=4"`
+	Debug         bool              `vault:"DEBUG,optional"`
+	Timeout       time.Duration     `vault:"TIMEOUT"`
+	Labels        map[string]string `vault:"LABELS"`
+	Ignored       string
+}
+
+func TestDecodeSecretMap(t *testing.T) {
+	var dst buildRunnerSecrets
+	err := DecodeSecretMap(VaultSecretMap{
+		BR_ACCESS_ENCRYPTION_KEY: "c2VjcmV0",
+		VPN_SERVER_PASSWORD_kEY:  "hunter2",
+		"TIMEOUT":                json.Number("90"),
+		"LABELS":                 `{"region":"india"}`,
+	}, &dst)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secret"), dst.EncryptionKey)
+	assert.Equal(t, "hunter2", dst.VPNPassword)
+	assert.Equal(t, 4, dst.MaxJobs)
+	assert.False(t, dst.Debug)
+	assert.Equal(t, 90*time.Second, dst.Timeout)
+	assert.Equal(t, map[string]string{"region": "india"}, dst.Labels)
+}
+
+func TestDecodeSecretMapAggregatesErrors(t *testing.T) {
+	var dst buildRunnerSecrets
+	err := DecodeSecretMap(VaultSecretMap{
+		BR_ACCESS_ENCRYPTION_KEY: "not base64!",
+		"MAX_JOBS":               "many",
+		"TIMEOUT":                "1m",
+		"LABELS":                 map[string]interface{}{"region": "us"},
+	}, &dst)
+
+	var decodeErr *DecodeError
+	assert.True(t, errors.As(err, &decodeErr))
+	assert.Len(t, decodeErr.Fields, 3)
+	assert.True(t, errors.Is(err, ErrSecretKeyMissing))
+	assert.True(t, errors.Is(err, ErrSecretValueMalformed))
+	assert.Contains(t, err.Error(), VPN_SERVER_PASSWORD_kEY)
+	assert.Contains(t, err.Error(), "MAX_JOBS")
+}
+
+type registryCredentials struct {
+	Username string `vault:"REGISTRY_USERNAME"`
+	Password string `vault:"REGISTRY_PASSWORD"`
+}
+
+type MirrorSecrets struct {
+	URL string `vault:"MIRROR_URL"`
+}
+
+type deploySecrets struct {
+	registryCredentials
+	*MirrorSecrets
+	Token   *string        `vault:"DEPLOY_TOKEN"`
+	Retries *int           `vault:"RETRIES"`
+	Timeout *time.Duration `vault:"TIMEOUT,optional"`
+	Region  interface{}    `vault:"REGION"`
+	Extra   interface{}    `vault:"EXTRA"`
+}
+
+func TestDecodeSecretMapPointersAndEmbedded(t *testing.T) {
+	var dst deploySecrets
+	err := DecodeSecretMap(VaultSecretMap{
+		"REGISTRY_USERNAME": "ci",
+		"REGISTRY_PASSWORD": "hunter2",
+		"MIRROR_URL":        "https://mirror.internal",
+		"DEPLOY_TOKEN":      "abc",
+		"RETRIES":           "3",
+		"REGION":            "ap-south-1",
+		"EXTRA":             map[string]interface{}{"zone": "a"},
+	}, &dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", dst.Username)
+	assert.Equal(t, "hunter2", dst.Password)
+	if assert.NotNil(t, dst.MirrorSecrets) {
+		assert.Equal(t, "https://mirror.internal", dst.URL)
+	}
+	if assert.NotNil(t, dst.Token) {
+		assert.Equal(t, "abc", *dst.Token)
+	}
+	if assert.NotNil(t, dst.Retries) {
+		assert.Equal(t, 3, *dst.Retries)
+	}
+	assert.Nil(t, dst.Timeout)
+	assert.Equal(t, "ap-south-1", dst.Region)
+	assert.Equal(t, map[string]interface{}{"zone": "a"}, dst.Extra)
+
+	// Fields of embedded structs are reported like any other
+	err = DecodeSecretMap(VaultSecretMap{"RETRIES": "many"}, &dst)
+	var decodeErr *DecodeError
+	if assert.True(t, errors.As(err, &decodeErr)) {
+		assert.Contains(t, err.Error(), "REGISTRY_PASSWORD")
+		assert.Contains(t, err.Error(), "RETRIES")
+	}
+}
+
+func TestGetSecretInto(t *testing.T) {
+	kv, vc := newFakeKV(t)
+	kv.put(INTERNAL_SERVICES_STORE, BUILD_RUNNER_SECRET_PATH, map[string]interface{}{
+		BR_ACCESS_ENCRYPTION_KEY: "c2VjcmV0",
+		VPN_SERVER_PASSWORD_kEY:  "hunter2",
+		"MAX_JOBS":               8,
+		"TIMEOUT":                "30s",
+		"LABELS":                 map[string]interface{}{"region": "us"},
+	})
+
+	var dst buildRunnerSecrets
+	err := vc.GetSecretInto(context.Background(), INTERNAL_SERVICES_STORE, BUILD_RUNNER_SECRET_PATH, &dst)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, dst.MaxJobs)
+	assert.Equal(t, 30*time.Second, dst.Timeout)
+	assert.Equal(t, "us", dst.Labels["region"])
+}
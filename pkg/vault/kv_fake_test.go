@@ -0,0 +1,185 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeKV is an in-memory stand-in for a KVv2 mount, serving just enough of
+// the HTTP API for the client methods under test.
+type fakeKV struct {
+	mu      sync.Mutex
+	secrets map[string][]fakeVersion
+	reads   int64
+}
+
+type fakeVersion struct {
+	data    map[string]interface{}
+	created time.Time
+}
+
+func newFakeKV(t *testing.T) (*fakeKV, *VaultClient) {
+	kv := &fakeKV{secrets: map[string][]fakeVersion{}}
+	server := httptest.NewServer(kv)
+	t.Cleanup(server.Close)
+
+	vc, err := New(WithAddress(server.URL), WithToken("token"), WithRetry(0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kv, vc
+}
+
+func (kv *fakeKV) put(store, path string, data map[string]interface{}) int {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	key := store + "/" + path
+	kv.secrets[key] = append(kv.secrets[key], fakeVersion{data: data, created: time.Now()})
+	return len(kv.secrets[key])
+}
+
+func (kv *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v1/"), "/", 3)
+	if len(parts) == 2 {
+		parts = append(parts, "")
+	}
+	if len(parts) < 3 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	store, kind, path := parts[0], parts[1], parts[2]
+
+	switch {
+	case kind == "data" && r.Method == http.MethodGet:
+		atomic.AddInt64(&kv.reads, 1)
+		kv.mu.Lock()
+		versions := kv.secrets[store+"/"+path]
+		kv.mu.Unlock()
+		if len(versions) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		v := len(versions)
+		if q := r.URL.Query().Get("version"); q != "" {
+			v, _ = strconv.Atoi(q)
+			if v < 1 || v > len(versions) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+		}
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     versions[v-1].data,
+				"metadata": versionMetadata(v, versions[v-1]),
+			},
+		})
+	case kind == "data" && (r.Method == http.MethodPut || r.Method == http.MethodPost || r.Method == http.MethodPatch):
+		var body struct {
+			Data    map[string]interface{} `json:"data"`
+			Options struct {
+				CAS *int `json:"cas"`
+			} `json:"options"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		kv.mu.Lock()
+		versions := kv.secrets[store+"/"+path]
+		kv.mu.Unlock()
+		if body.Options.CAS != nil && *body.Options.CAS != len(versions) {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]interface{}{"errors": []string{"check-and-set parameter did not match the current version"}})
+			return
+		}
+		data := body.Data
+		if r.Method == http.MethodPatch {
+			if len(versions) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			data = map[string]interface{}{}
+			for k, v := range versions[len(versions)-1].data {
+				data[k] = v
+			}
+			for k, v := range body.Data {
+				data[k] = v
+			}
+		}
+		v := kv.put(store, path, data)
+		writeJSON(w, map[string]interface{}{"data": versionMetadata(v, fakeVersion{created: time.Now()})})
+	case kind == "metadata" && r.Method == http.MethodGet && r.URL.Query().Get("list") == "true":
+		if path != "" && !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+		kv.mu.Lock()
+		seen := map[string]bool{}
+		var keys []string
+		for key := range kv.secrets {
+			rest := strings.TrimPrefix(key, store+"/"+path)
+			if rest == key || rest == "" {
+				continue
+			}
+			if idx := strings.Index(rest, "/"); idx >= 0 {
+				rest = rest[:idx+1]
+			}
+			if !seen[rest] {
+				seen[rest] = true
+				keys = append(keys, rest)
+			}
+		}
+		kv.mu.Unlock()
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+	case kind == "metadata" && r.Method == http.MethodGet:
+		kv.mu.Lock()
+		versions := kv.secrets[store+"/"+path]
+		kv.mu.Unlock()
+		if len(versions) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		versionMap := map[string]interface{}{}
+		for i, v := range versions {
+			versionMap[strconv.Itoa(i+1)] = versionMetadata(i+1, v)
+		}
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{
+				"current_version":      len(versions),
+				"oldest_version":       1,
+				"max_versions":         0,
+				"cas_required":         false,
+				"delete_version_after": "0s",
+				"created_time":         versions[0].created.Format(time.RFC3339Nano),
+				"updated_time":         versions[len(versions)-1].created.Format(time.RFC3339Nano),
+				"custom_metadata":      nil,
+				"versions":             versionMap,
+			},
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func versionMetadata(version int, v fakeVersion) map[string]interface{} {
+	return map[string]interface{}{
+		"version":         version,
+		"created_time":    v.created.Format(time.RFC3339Nano),
+		"deletion_time":   "",
+		"destroyed":       false,
+		"custom_metadata": nil,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,102 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// Lease is a dynamic secret issued by a secrets engine, such as cloud
+// credentials or a certificate, together with its lease information.
+type Lease struct {
+	ID        string
+	Duration  time.Duration
+	Renewable bool
+	IssuedAt  time.Time
+	Data      map[string]interface{}
+}
+
+// ExpiresAt returns when the lease expires. It is zero for secrets without a
+// lease duration.
+func (l *Lease) ExpiresAt() time.Time {
+	if l.Duration == 0 {
+		return time.Time{}
+	}
+	return l.IssuedAt.Add(l.Duration)
+}
+
+// ReadLease issues a dynamic secret by reading path, passing query as URL
+// parameters.
+func (vc *VaultClient) ReadLease(ctx context.Context, path string, query map[string][]string) (*Lease, error) {
+	ctx, span := startSpan(ctx, "vault.ReadLease", "", path)
+	defer span.End()
+
+	secret, err := vc.client(ctx).Logical().ReadWithDataWithContext(ctx, path, query)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	return newLease(path, secret)
+}
+
+// WriteLease issues a dynamic secret by writing data to path.
+func (vc *VaultClient) WriteLease(ctx context.Context, path string, data map[string]interface{}) (*Lease, error) {
+	ctx, span := startSpan(ctx, "vault.WriteLease", "", path)
+	defer span.End()
+
+	secret, err := vc.client(ctx).Logical().WriteWithContext(ctx, path, data)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("unable to write %s: %v", path, err)
+	}
+	return newLease(path, secret)
+}
+
+// RenewLease extends lease by increment, or by the default TTL of the secrets
+// engine when increment is zero, and updates its duration in place. Vault may
+// grant less than increment once the lease approaches its max TTL.
+func (vc *VaultClient) RenewLease(ctx context.Context, lease *Lease, increment time.Duration) error {
+	ctx, span := startSpan(ctx, "vault.RenewLease", "", lease.ID)
+	defer span.End()
+
+	secret, err := vc.client(ctx).Sys().RenewWithContext(ctx, lease.ID, int(increment.Seconds()))
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("unable to renew lease: %v", err)
+	}
+	if secret == nil {
+		return fmt.Errorf("no lease info returned on renewal")
+	}
+	lease.Duration = time.Duration(secret.LeaseDuration) * time.Second
+	lease.Renewable = secret.Renewable
+	lease.IssuedAt = time.Now()
+	return nil
+}
+
+// RevokeLease revokes the lease with the given id, invalidating the secret
+// it was issued for.
+func (vc *VaultClient) RevokeLease(ctx context.Context, leaseID string) error {
+	ctx, span := startSpan(ctx, "vault.RevokeLease", "", leaseID)
+	defer span.End()
+
+	if err := vc.client(ctx).Sys().RevokeWithContext(ctx, leaseID); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("unable to revoke lease: %v", err)
+	}
+	return nil
+}
+
+func newLease(path string, secret *vault.Secret) (*Lease, error) {
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("no data returned from %s", path)
+	}
+	return &Lease{
+		ID:        secret.LeaseID,
+		Duration:  time.Duration(secret.LeaseDuration) * time.Second,
+		Renewable: secret.Renewable,
+		IssuedAt:  time.Now(),
+		Data:      secret.Data,
+	}, nil
+}
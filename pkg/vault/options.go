@@ -0,0 +1,159 @@
+package vault
+
+import (
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// TokenSource returns the token the client should authenticate with. It is
+// called once while the client is being constructed.
+type TokenSource func() (string, error)
+
+// Option configures a VaultClient created through New.
+type Option func(*options)
+
+type options struct {
+	address      string
+	namespace    string
+	tls          *vault.TLSConfig
+	timeout      time.Duration
+	maxRetries   *int
+	minRetryWait time.Duration
+	maxRetryWait time.Duration
+	token        *string
+	tokenSource  TokenSource
+	auth         AuthMethod
+	onRenewal    func(RenewalEvent)
+	cacheTTL     time.Duration
+	cacheStale   time.Duration
+}
+
+// WithAddress sets the address of the Vault server, overriding VAULT_ADDR.
+func WithAddress(address string) Option {
+	return func(o *options) {
+		o.address = address
+	}
+}
+
+// WithNamespace sets the Vault namespace every request is scoped to,
+// overriding VAULT_NAMESPACE.
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithCACert sets the path to a PEM encoded CA certificate used to verify
+// the Vault server, overriding VAULT_CACERT.
+func WithCACert(path string) Option {
+	return func(o *options) {
+		o.tlsConfig().CACert = path
+	}
+}
+
+// WithCACertBytes sets a PEM encoded CA certificate used to verify the
+// Vault server, overriding VAULT_CACERT_BYTES.
+func WithCACertBytes(pem []byte) Option {
+	return func(o *options) {
+		o.tlsConfig().CACertBytes = pem
+	}
+}
+
+// WithClientCert sets the paths to the PEM encoded client certificate and
+// key presented to the Vault server, overriding VAULT_CLIENT_CERT and
+// VAULT_CLIENT_KEY.
+func WithClientCert(certPath, keyPath string) Option {
+	return func(o *options) {
+		t := o.tlsConfig()
+		t.ClientCert = certPath
+		t.ClientKey = keyPath
+	}
+}
+
+// WithTLSServerName sets the SNI host name used when connecting to the
+// Vault server, overriding VAULT_TLS_SERVER_NAME.
+func WithTLSServerName(name string) Option {
+	return func(o *options) {
+		o.tlsConfig().TLSServerName = name
+	}
+}
+
+// WithInsecureSkipVerify disables verification of the Vault server
+// certificate. It should only be used against local dev servers.
+func WithInsecureSkipVerify() Option {
+	return func(o *options) {
+		o.tlsConfig().Insecure = true
+	}
+}
+
+// WithTimeout sets the per request timeout, overriding VAULT_CLIENT_TIMEOUT.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetry sets how many times a request failing with a 5xx error is
+// retried and the bounds of the wait between attempts. A zero wait keeps the
+// Vault client default.
+func WithRetry(maxRetries int, minWait, maxWait time.Duration) Option {
+	return func(o *options) {
+		o.maxRetries = &maxRetries
+		o.minRetryWait = minWait
+		o.maxRetryWait = maxWait
+	}
+}
+
+// WithToken sets a static token, overriding VAULT_TOKEN. An empty token
+// leaves the client unauthenticated rather than falling back to VAULT_TOKEN.
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = &token
+	}
+}
+
+// WithTokenSource sets a function the token is fetched from. It takes
+// precedence over WithToken and VAULT_TOKEN.
+func WithTokenSource(source TokenSource) Option {
+	return func(o *options) {
+		o.tokenSource = source
+	}
+}
+
+// WithAuth logs in with the given auth method instead of using a static
+// token. The token is renewed in the background and the client logs in again
+// when renewal fails, until Close is called.
+func WithAuth(method AuthMethod) Option {
+	return func(o *options) {
+		o.auth = method
+	}
+}
+
+// WithRenewalCallback registers a function called on every login, renewal
+// and renewal failure of the token obtained through WithAuth. It is called
+// from the renewal goroutine and should not block.
+func WithRenewalCallback(fn func(RenewalEvent)) Option {
+	return func(o *options) {
+		o.onRenewal = fn
+	}
+}
+
+// WithCache caches secret reads in process for ttl. Once an entry is older
+// than ttl it is still served for up to staleTTL while it is refreshed in the
+// background, after which the next read waits for Vault again.
+func WithCache(ttl, staleTTL time.Duration) Option {
+	return func(o *options) {
+		o.cacheTTL = ttl
+		o.cacheStale = staleTTL
+	}
+}
+
+// tlsConfig returns the TLS configuration being built. It is applied on top
+// of whatever the standard Vault environment variables already configured.
+func (o *options) tlsConfig() *vault.TLSConfig {
+	if o.tls == nil {
+		o.tls = &vault.TLSConfig{}
+	}
+	return o.tls
+}
@@ -0,0 +1,228 @@
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_PKI_MOUNT = "pki"
+
+	// pkiRetryInterval is how long to wait before retrying a failed renewal.
+	pkiRetryInterval = 30 * time.Second
+	// pkiMinRenewalWait is the shortest wait between two renewal attempts, so
+	// a certificate that is already due or expired is not renewed in a loop.
+	pkiMinRenewalWait = time.Second
+)
+
+// PKI issues certificates from a role of the Vault PKI engine.
+type PKI struct {
+	vc        *VaultClient
+	mountPath string
+	role      string
+}
+
+// CertificateRequest describes the certificate to issue.
+type CertificateRequest struct {
+	CommonName string
+	AltNames   []string
+	IPSANs     []string
+	URISANs    []string
+	// TTL of the certificate, the role default is used when zero
+	TTL time.Duration
+	// RenewBefore is how long before expiry TLSConfig renews the certificate,
+	// defaults to a third of its lifetime.
+	RenewBefore time.Duration
+	// OnRenewalError is called by TLSConfig when a renewal fails. The current
+	// certificate is kept and the renewal retried.
+	OnRenewalError func(error)
+}
+
+// IssuedCertificate is a certificate issued by the PKI engine together with
+// its private key and the CA chain it was issued by.
+type IssuedCertificate struct {
+	Certificate  tls.Certificate
+	Leaf         *x509.Certificate
+	CAPool       *x509.CertPool
+	SerialNumber string
+}
+
+// NewPKI returns a PKI client for role in the PKI engine mounted at
+// mountPath, which defaults to DEFAULT_PKI_MOUNT.
+func NewPKI(vc *VaultClient, mountPath, role string) *PKI {
+	return &PKI{vc: vc, mountPath: mountOrDefault(mountPath, DEFAULT_PKI_MOUNT), role: role}
+}
+
+// Issue issues a new certificate and private key. The private key is only
+// held in memory and never stored by Vault.
+func (p *PKI) Issue(ctx context.Context, req *CertificateRequest) (*IssuedCertificate, error) {
+	params := map[string]interface{}{"common_name": req.CommonName}
+	if len(req.AltNames) > 0 {
+		params["alt_names"] = strings.Join(req.AltNames, ",")
+	}
+	if len(req.IPSANs) > 0 {
+		params["ip_sans"] = strings.Join(req.IPSANs, ",")
+	}
+	if len(req.URISANs) > 0 {
+		params["uri_sans"] = strings.Join(req.URISANs, ",")
+	}
+	if req.TTL > 0 {
+		params["ttl"] = req.TTL.String()
+	}
+
+	lease, err := p.vc.WriteLease(ctx, fmt.Sprintf("%s/issue/%s", p.mountPath, p.role), params)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM, err := stringField(lease.Data, "certificate")
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := stringField(lease.Data, "private_key")
+	if err != nil {
+		return nil, err
+	}
+	issuingCA, err := stringField(lease.Data, "issuing_ca")
+	if err != nil {
+		return nil, err
+	}
+	caChain := []string{issuingCA}
+	if chain, ok := lease.Data["ca_chain"].([]interface{}); ok {
+		for _, c := range chain {
+			if pem, ok := c.(string); ok {
+				caChain = append(caChain, pem)
+			}
+		}
+	}
+
+	// Present the issuing CA along with the leaf so peers only need the root
+	cert, err := tls.X509KeyPair([]byte(certPEM+"\n"+issuingCA), []byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse issued certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse issued certificate: %v", err)
+	}
+	cert.Leaf = leaf
+
+	pool := x509.NewCertPool()
+	for _, pem := range caChain {
+		if !pool.AppendCertsFromPEM([]byte(pem)) {
+			return nil, fmt.Errorf("unable to parse issuing CA certificate")
+		}
+	}
+
+	serial, _ := lease.Data["serial_number"].(string)
+	return &IssuedCertificate{Certificate: cert, Leaf: leaf, CAPool: pool, SerialNumber: serial}, nil
+}
+
+// TLSConfig issues a certificate and returns a TLS config for mutual TLS that
+// presents it both as a server and as a client, and only accepts peers with
+// a certificate issued by the same CA. The certificate is renewed in the
+// background before it expires until ctx is done, so the config can be used
+// for long running servers and clients.
+//
+// The CA pool is taken from the first certificate, a new config is needed
+// once the issuing CA is rotated.
+func (p *PKI) TLSConfig(ctx context.Context, req *CertificateRequest) (*tls.Config, error) {
+	issued, err := p.Issue(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &certRenewer{pki: p, req: req, current: issued}
+	go r.run(ctx)
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+		RootCAs:    issued.CAPool,
+		ClientCAs:  issued.CAPool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}, nil
+}
+
+// certRenewer holds the certificate served by a TLSConfig and replaces it
+// before it expires.
+type certRenewer struct {
+	pki *PKI
+	req *CertificateRequest
+
+	mu      sync.RWMutex
+	current *IssuedCertificate
+}
+
+func (r *certRenewer) certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &r.current.Certificate
+}
+
+func (r *certRenewer) run(ctx context.Context) {
+	wait := r.renewIn()
+	for {
+		if wait < pkiMinRenewalWait {
+			wait = pkiMinRenewalWait
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		issued, err := r.pki.Issue(ctx, r.req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if r.req.OnRenewalError != nil {
+				r.req.OnRenewalError(err)
+			}
+			wait = pkiRetryInterval
+			if untilExpiry := time.Until(r.expiry()); untilExpiry/2 < wait {
+				wait = untilExpiry / 2
+			}
+			continue
+		}
+
+		r.mu.Lock()
+		r.current = issued
+		r.mu.Unlock()
+		wait = r.renewIn()
+	}
+}
+
+func (r *certRenewer) expiry() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current.Leaf.NotAfter
+}
+
+// renewIn returns how long until the current certificate should be renewed.
+func (r *certRenewer) renewIn() time.Duration {
+	r.mu.RLock()
+	leaf := r.current.Leaf
+	r.mu.RUnlock()
+
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	renewBefore := r.req.RenewBefore
+	if renewBefore <= 0 || renewBefore >= lifetime {
+		renewBefore = lifetime / 3
+	}
+	if wait := time.Until(leaf.NotAfter.Add(-renewBefore)); wait > pkiMinRenewalWait {
+		return wait
+	}
+	return pkiMinRenewalWait
+}
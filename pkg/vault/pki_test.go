@@ -0,0 +1,153 @@
+package vault
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePKI signs certificates for pki/issue/<role> with a throwaway CA.
+type fakePKI struct {
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	caPEM  string
+	ttl    time.Duration
+	serial int64
+}
+
+func newFakePKI(t *testing.T, ttl time.Duration) (*fakePKI, *VaultClient) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "internal CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	ca, _ := x509.ParseCertificate(der)
+
+	p := &fakePKI{ca: ca, caKey: caKey, ttl: ttl, serial: 1}
+	p.caPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	server := httptest.NewServer(p)
+	t.Cleanup(server.Close)
+	vc, err := New(WithAddress(server.URL), WithToken("token"), WithRetry(0, 0, 0))
+	assert.NoError(t, err)
+	return p, vc
+}
+
+func (p *fakePKI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/pki/issue/service" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var body struct {
+		CommonName string `json:"common_name"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serial := atomic.AddInt64(&p.serial, 1)
+	// NotBefore is backdated as certificates only have second precision
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: body.CommonName},
+		DNSNames:     []string{body.CommonName},
+		NotBefore:    time.Now().Add(-time.Second),
+		NotAfter:     time.Now().Add(p.ttl),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	writeJSON(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"certificate":   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+			"private_key":   string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+			"issuing_ca":    p.caPEM,
+			"ca_chain":      []string{p.caPEM},
+			"serial_number": big.NewInt(serial).String(),
+		},
+	})
+}
+
+func TestPKIIssue(t *testing.T) {
+	_, vc := newFakePKI(t, time.Hour)
+	pki := NewPKI(vc, "", "service")
+
+	issued, err := pki.Issue(context.Background(), &CertificateRequest{CommonName: "builder.internal"})
+	assert.NoError(t, err)
+	assert.Equal(t, "builder.internal", issued.Leaf.Subject.CommonName)
+	assert.Len(t, issued.Certificate.Certificate, 2)
+	_, err = issued.Leaf.Verify(x509.VerifyOptions{DNSName: "builder.internal", Roots: issued.CAPool})
+	assert.NoError(t, err)
+}
+
+func TestPKITLSConfig(t *testing.T) {
+	_, vc := newFakePKI(t, 3*time.Second)
+	pki := NewPKI(vc, "", "service")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverConfig, err := pki.TLSConfig(ctx, &CertificateRequest{CommonName: "api.internal"})
+	assert.NoError(t, err)
+	clientConfig, err := pki.TLSConfig(ctx, &CertificateRequest{CommonName: "worker.internal"})
+	assert.NoError(t, err)
+	clientConfig.ServerName = "api.internal"
+
+	// Both sides verify each other against the issuing CA
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	errs := make(chan error, 1)
+	go func() { errs <- tls.Server(serverConn, serverConfig).Handshake() }()
+	client := tls.Client(clientConn, clientConfig)
+	require.NoError(t, client.Handshake())
+	require.NoError(t, <-errs)
+	assert.Equal(t, "api.internal", client.ConnectionState().PeerCertificates[0].Subject.CommonName)
+
+	// The certificate is replaced once two thirds of its lifetime have passed
+	first, _ := serverConfig.GetCertificate(nil)
+	assert.Eventually(t, func() bool {
+		current, _ := serverConfig.GetCertificate(nil)
+		return current.Leaf.SerialNumber.Cmp(first.Leaf.SerialNumber) != 0
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestPKIRenewIn(t *testing.T) {
+	now := time.Now()
+	r := &certRenewer{req: &CertificateRequest{RenewBefore: 10 * time.Hour}, current: &IssuedCertificate{Leaf: &x509.Certificate{
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(30 * time.Hour),
+	}}}
+	assert.InDelta(t, float64(20*time.Hour), float64(r.renewIn()), float64(time.Minute))
+
+	// Certificates due for renewal or expired are retried, not renewed in a
+	// busy loop
+	r.current.Leaf.NotAfter = now.Add(time.Minute)
+	assert.Equal(t, pkiMinRenewalWait, r.renewIn())
+	r.current.Leaf.NotAfter = now.Add(-time.Minute)
+	assert.Equal(t, pkiMinRenewalWait, r.renewIn())
+}
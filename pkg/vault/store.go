@@ -0,0 +1,207 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrSecretNotFound is matched by errors.Is when a secret does not exist, or
+// its latest version is deleted.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretStore is a backend secrets are read from and written to. VaultClient
+// implements it on the default KV store, and Store returns one for any other
+// KV store. EnvStore, FileStore and MemoryStore implement it without Vault
+// for local development and tests.
+type SecretStore interface {
+	// Get returns a single key of the secret at path, failing with
+	// ErrSecretKeyMissing when the secret exists but the key does not.
+	Get(ctx context.Context, path, key string) (string, error)
+	// GetMap returns every key of the secret at path.
+	GetMap(ctx context.Context, path string) (VaultSecretMap, error)
+	// Put replaces the secret at path with data.
+	Put(ctx context.Context, path string, data VaultSecretMap) error
+	// List returns the paths of every secret under prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete removes the secret at path.
+	Delete(ctx context.Context, path string) error
+}
+
+// StoreSelector is implemented by secret stores holding several named KV
+// stores, like VaultClient, and by stores wrapping them, like ChainStore.
+// Check for it to read from a given KV store whatever the store is wrapped in.
+type StoreSelector interface {
+	// SelectStore returns the store reading and writing secrets in kvStore.
+	SelectStore(kvStore string) SecretStore
+}
+
+// KVStore is a SecretStore backed by a single Vault KVv2 store.
+type KVStore struct {
+	vc      *VaultClient
+	kvStore string
+}
+
+// Store returns a SecretStore reading and writing secrets in kvStore.
+func (vc *VaultClient) Store(kvStore string) *KVStore {
+	return &KVStore{vc: vc, kvStore: kvStore}
+}
+
+// SelectStore returns kvStore of the same Vault client.
+func (vc *VaultClient) SelectStore(kvStore string) SecretStore {
+	return vc.Store(kvStore)
+}
+
+// SelectStore returns kvStore of the same Vault client, so a KVStore can be
+// narrowed down to another store like its client.
+func (s *KVStore) SelectStore(kvStore string) SecretStore {
+	return s.vc.Store(kvStore)
+}
+
+func (s *KVStore) Get(ctx context.Context, path, key string) (string, error) {
+	secret, err := s.GetMap(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return secretValue(secret, path, key)
+}
+
+func (s *KVStore) GetMap(ctx context.Context, path string) (VaultSecretMap, error) {
+	return s.vc.readSecret(ctx, s.kvStore, path)
+}
+
+func (s *KVStore) Put(ctx context.Context, path string, data VaultSecretMap) error {
+	_, err := s.vc.PutSecretMap(ctx, s.kvStore, path, data)
+	return err
+}
+
+func (s *KVStore) List(ctx context.Context, prefix string) ([]string, error) {
+	return s.vc.ListSecrets(ctx, s.kvStore, prefix, true)
+}
+
+// Delete soft-deletes the latest version of the secret, see DeleteSecret.
+func (s *KVStore) Delete(ctx context.Context, path string) error {
+	return s.vc.DeleteSecret(ctx, s.kvStore, path)
+}
+
+func (vc *VaultClient) Get(ctx context.Context, path, key string) (string, error) {
+	return vc.Store(DEFAULT_KV_STORE).Get(ctx, path, key)
+}
+
+func (vc *VaultClient) GetMap(ctx context.Context, path string) (VaultSecretMap, error) {
+	return vc.Store(DEFAULT_KV_STORE).GetMap(ctx, path)
+}
+
+func (vc *VaultClient) Put(ctx context.Context, path string, data VaultSecretMap) error {
+	return vc.Store(DEFAULT_KV_STORE).Put(ctx, path, data)
+}
+
+func (vc *VaultClient) List(ctx context.Context, prefix string) ([]string, error) {
+	return vc.Store(DEFAULT_KV_STORE).List(ctx, prefix)
+}
+
+func (vc *VaultClient) Delete(ctx context.Context, path string) error {
+	return vc.Store(DEFAULT_KV_STORE).Delete(ctx, path)
+}
+
+// ChainStore tries several stores in order, for example the environment, then
+// a local file, then Vault.
+type ChainStore struct {
+	stores []SecretStore
+}
+
+// NewChainStore returns a store reading from the first of stores that has the
+// secret. Writes and deletes only go to the first store.
+func NewChainStore(stores ...SecretStore) *ChainStore {
+	return &ChainStore{stores: stores}
+}
+
+// SelectStore returns a chain of the same stores, where every store that is
+// a StoreSelector is narrowed down to kvStore and the others are kept as is.
+func (c *ChainStore) SelectStore(kvStore string) SecretStore {
+	stores := make([]SecretStore, len(c.stores))
+	for i, store := range c.stores {
+		if selector, ok := store.(StoreSelector); ok {
+			store = selector.SelectStore(kvStore)
+		}
+		stores[i] = store
+	}
+	return NewChainStore(stores...)
+}
+
+// Get returns the key from the first store that has it. Stores that do not
+// have the secret or the key are skipped, any other error is returned.
+func (c *ChainStore) Get(ctx context.Context, path, key string) (string, error) {
+	for _, store := range c.stores {
+		value, err := store.Get(ctx, path, key)
+		if errors.Is(err, ErrSecretNotFound) || errors.Is(err, ErrSecretKeyMissing) {
+			continue
+		}
+		return value, err
+	}
+	return "", fmt.Errorf("%w: %s", ErrSecretNotFound, path)
+}
+
+// GetMap returns the secret from the first store that has it. Stores that do
+// not have the secret are skipped, any other error is returned.
+func (c *ChainStore) GetMap(ctx context.Context, path string) (VaultSecretMap, error) {
+	for _, store := range c.stores {
+		secret, err := store.GetMap(ctx, path)
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		return secret, err
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, path)
+}
+
+func (c *ChainStore) Put(ctx context.Context, path string, data VaultSecretMap) error {
+	if len(c.stores) == 0 {
+		return fmt.Errorf("no secret store configured")
+	}
+	return c.stores[0].Put(ctx, path, data)
+}
+
+// List returns the paths found in any of the stores.
+func (c *ChainStore) List(ctx context.Context, prefix string) ([]string, error) {
+	seen := map[string]bool{}
+	for _, store := range c.stores {
+		paths, err := store.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			seen[path] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+func (c *ChainStore) Delete(ctx context.Context, path string) error {
+	if len(c.stores) == 0 {
+		return fmt.Errorf("no secret store configured")
+	}
+	return c.stores[0].Delete(ctx, path)
+}
+
+func secretValue(secret VaultSecretMap, path, key string) (string, error) {
+	raw, ok := secret[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %s in %s", ErrSecretKeyMissing, key, path)
+	}
+	value, err := toString(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s in %s: %v", ErrSecretValueMalformed, key, path, err)
+	}
+	return value, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,116 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ENV_PATH_SEPARATOR separates the secret path from the key in the names of
+// environment variables and dotenv entries.
+const ENV_PATH_SEPARATOR = "__"
+
+// EnvStore is a SecretStore reading secrets from environment variables. The
+// key KEY of the secret at path is read from <prefix><PATH>__KEY, where PATH
+// is path upper cased with anything but letters and digits replaced by "_".
+// As that mapping is lossy, List returns the normalized paths.
+type EnvStore struct {
+	prefix string
+}
+
+// NewEnvStore returns a store reading variables starting with prefix.
+func NewEnvStore(prefix string) *EnvStore {
+	return &EnvStore{prefix: prefix}
+}
+
+func (s *EnvStore) Get(ctx context.Context, path, key string) (string, error) {
+	if value, ok := os.LookupEnv(s.prefix + envName(path) + ENV_PATH_SEPARATOR + key); ok {
+		return value, nil
+	}
+	secret, err := s.GetMap(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return secretValue(secret, path, key)
+}
+
+func (s *EnvStore) GetMap(ctx context.Context, path string) (VaultSecretMap, error) {
+	secretPrefix := s.prefix + envName(path) + ENV_PATH_SEPARATOR
+	secret := VaultSecretMap{}
+	for _, entry := range os.Environ() {
+		name, value, _ := cut(entry, "=")
+		if key := strings.TrimPrefix(name, secretPrefix); key != name && key != "" {
+			secret[key] = value
+		}
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, path)
+	}
+	return secret, nil
+}
+
+func (s *EnvStore) Put(ctx context.Context, path string, data VaultSecretMap) error {
+	// Put replaces the secret, so keys missing from data are unset first
+	if err := s.Delete(ctx, path); err != nil && !errors.Is(err, ErrSecretNotFound) {
+		return err
+	}
+	for key, raw := range data {
+		value, err := toString(raw)
+		if err != nil {
+			return fmt.Errorf("%w: %s in %s: %v", ErrSecretValueMalformed, key, path, err)
+		}
+		if err := os.Setenv(s.prefix+envName(path)+ENV_PATH_SEPARATOR+key, value); err != nil {
+			return fmt.Errorf("unable to set environment variable: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *EnvStore) List(ctx context.Context, prefix string) ([]string, error) {
+	listPrefix := envName(prefix)
+	paths := map[string]bool{}
+	for _, entry := range os.Environ() {
+		name, _, _ := cut(entry, "=")
+		if !strings.HasPrefix(name, s.prefix) {
+			continue
+		}
+		path, _, ok := cut(strings.TrimPrefix(name, s.prefix), ENV_PATH_SEPARATOR)
+		if ok && path != "" && strings.HasPrefix(path, listPrefix) {
+			paths[path] = true
+		}
+	}
+	return sortedKeys(paths), nil
+}
+
+func (s *EnvStore) Delete(ctx context.Context, path string) error {
+	secret, err := s.GetMap(ctx, path)
+	if err != nil {
+		return err
+	}
+	for key := range secret {
+		os.Unsetenv(s.prefix + envName(path) + ENV_PATH_SEPARATOR + key)
+	}
+	return nil
+}
+
+// envName converts a secret path to the form used in variable names, e.g.
+// "US-GCP-ACCOUNT" becomes "US_GCP_ACCOUNT".
+func envName(path string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, strings.Trim(path, "/"))
+}
+
+// cut is strings.Cut, which is not available in go 1.17.
+func cut(s, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
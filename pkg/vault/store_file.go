@@ -0,0 +1,205 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+type FileFormat string
+
+const (
+	FILE_FORMAT_DOTENV FileFormat = "dotenv"
+	FILE_FORMAT_JSON   FileFormat = "json"
+	FILE_FORMAT_YAML   FileFormat = "yaml"
+)
+
+// FileStore is a SecretStore backed by a local file, for development. JSON
+// and YAML files map each secret path to an object of keys. Dotenv files hold
+// one PATH__KEY=value entry per key, named like the variables of EnvStore.
+// Writes are saved back to the file.
+type FileStore struct {
+	filename string
+	format   FileFormat
+
+	mu      sync.Mutex
+	secrets *MemoryStore
+}
+
+// NewFileStore loads the secrets in filename. The format is detected from the
+// extension: .json, .yaml or .yml, and dotenv for anything else.
+func NewFileStore(filename string) (*FileStore, error) {
+	format := FILE_FORMAT_DOTENV
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		format = FILE_FORMAT_JSON
+	case ".yaml", ".yml":
+		format = FILE_FORMAT_YAML
+	}
+	return NewFileStoreWithFormat(filename, format)
+}
+
+// NewFileStoreWithFormat loads the secrets in filename, written in format.
+func NewFileStoreWithFormat(filename string, format FileFormat) (*FileStore, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read secrets file: %v", err)
+	}
+
+	secrets := map[string]VaultSecretMap{}
+	switch format {
+	case FILE_FORMAT_JSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&secrets)
+	case FILE_FORMAT_YAML:
+		err = yaml.Unmarshal(data, &secrets)
+	case FILE_FORMAT_DOTENV:
+		secrets, err = parseDotenv(data)
+	default:
+		return nil, fmt.Errorf("unsupported secrets file format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode secrets file %s: %v", filename, err)
+	}
+
+	return &FileStore{filename: filename, format: format, secrets: NewMemoryStore(secrets)}, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, path, key string) (string, error) {
+	return s.secrets.Get(ctx, s.key(path), key)
+}
+
+func (s *FileStore) GetMap(ctx context.Context, path string) (VaultSecretMap, error) {
+	return s.secrets.GetMap(ctx, s.key(path))
+}
+
+func (s *FileStore) Put(ctx context.Context, path string, data VaultSecretMap) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.secrets.Put(ctx, s.key(path), data); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *FileStore) List(ctx context.Context, prefix string) ([]string, error) {
+	if s.format == FILE_FORMAT_DOTENV {
+		// Dotenv paths are flat, so match on the start of the name instead
+		all, _ := s.secrets.List(ctx, "")
+		var paths []string
+		for _, path := range all {
+			if strings.HasPrefix(path, envName(prefix)) {
+				paths = append(paths, path)
+			}
+		}
+		return paths, nil
+	}
+	return s.secrets.List(ctx, prefix)
+}
+
+func (s *FileStore) Delete(ctx context.Context, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.secrets.Delete(ctx, s.key(path)); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *FileStore) key(path string) string {
+	if s.format == FILE_FORMAT_DOTENV {
+		return envName(path)
+	}
+	return strings.TrimPrefix(path, "/")
+}
+
+func (s *FileStore) save() error {
+	s.secrets.mu.RLock()
+	secrets := s.secrets.secrets
+	var data []byte
+	var err error
+	switch s.format {
+	case FILE_FORMAT_JSON:
+		data, err = json.MarshalIndent(secrets, "", "  ")
+	case FILE_FORMAT_YAML:
+		data, err = yaml.Marshal(secrets)
+	default:
+		data, err = formatDotenv(secrets)
+	}
+	s.secrets.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("unable to encode secrets file: %v", err)
+	}
+
+	if err := os.WriteFile(s.filename, data, 0600); err != nil {
+		return fmt.Errorf("unable to write secrets file: %v", err)
+	}
+	return nil
+}
+
+func parseDotenv(data []byte) (map[string]VaultSecretMap, error) {
+	secrets := map[string]VaultSecretMap{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing '='", lineNo)
+		}
+		path, key, ok := cut(strings.TrimSpace(name), ENV_PATH_SEPARATOR)
+		if !ok || path == "" || key == "" {
+			return nil, fmt.Errorf("line %d: %s is not of the form PATH%sKEY", lineNo, name, ENV_PATH_SEPARATOR)
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			value = unquoted
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		}
+
+		if secrets[path] == nil {
+			secrets[path] = VaultSecretMap{}
+		}
+		secrets[path][key] = value
+	}
+	return secrets, scanner.Err()
+}
+
+func formatDotenv(secrets map[string]VaultSecretMap) ([]byte, error) {
+	var lines []string
+	for path, secret := range secrets {
+		for key, raw := range secret {
+			value, err := toString(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s%s%s: %v", path, ENV_PATH_SEPARATOR, key, err)
+			}
+			lines = append(lines, fmt.Sprintf("%s%s%s=%s", path, ENV_PATH_SEPARATOR, key, strconv.Quote(value)))
+		}
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
@@ -0,0 +1,81 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MemoryStore is a SecretStore holding secrets in memory, for tests.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	secrets map[string]VaultSecretMap
+}
+
+// NewMemoryStore returns a store holding a copy of secrets, keyed by path.
+func NewMemoryStore(secrets map[string]VaultSecretMap) *MemoryStore {
+	s := &MemoryStore{secrets: make(map[string]VaultSecretMap, len(secrets))}
+	for path, data := range secrets {
+		s.secrets[path] = copySecretMap(data)
+	}
+	return s
+}
+
+func (s *MemoryStore) Get(ctx context.Context, path, key string) (string, error) {
+	secret, err := s.GetMap(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return secretValue(secret, path, key)
+}
+
+func (s *MemoryStore) GetMap(ctx context.Context, path string) (VaultSecretMap, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	secret, ok := s.secrets[path]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, path)
+	}
+	return copySecretMap(secret), nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, path string, data VaultSecretMap) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[path] = copySecretMap(data)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return listPaths(s.secrets, prefix), nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.secrets[path]; !ok {
+		return fmt.Errorf("%w: %s", ErrSecretNotFound, path)
+	}
+	delete(s.secrets, path)
+	return nil
+}
+
+// listPaths returns the sorted paths of secrets starting with prefix.
+func listPaths(secrets map[string]VaultSecretMap, prefix string) []string {
+	prefix = strings.TrimPrefix(prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	matches := map[string]bool{}
+	for path := range secrets {
+		if strings.HasPrefix(path, prefix) {
+			matches[path] = true
+		}
+	}
+	return sortedKeys(matches)
+}
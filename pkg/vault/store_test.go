@@ -0,0 +1,137 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(map[string]VaultSecretMap{"app/db": {"USER": "admin", "PORT": 5432}})
+
+	value, err := store.Get(ctx, "app/db", "PORT")
+	assert.NoError(t, err)
+	assert.Equal(t, "5432", value)
+
+	_, err = store.Get(ctx, "app/db", "PASSWORD")
+	assert.True(t, errors.Is(err, ErrSecretKeyMissing))
+	_, err = store.GetMap(ctx, "app/cache")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+
+	assert.NoError(t, store.Put(ctx, "app/cache", VaultSecretMap{"URL": "redis://"}))
+	assert.NoError(t, store.Put(ctx, "other", VaultSecretMap{"K": "V"}))
+	paths, err := store.List(ctx, "app")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app/cache", "app/db"}, paths)
+
+	assert.NoError(t, store.Delete(ctx, "app/cache"))
+	_, err = store.GetMap(ctx, "app/cache")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+}
+
+func TestEnvStore(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TEST_US_GCP_ACCOUNT__GCP_CREDENTIALS_JSON", "{}")
+	t.Setenv("TEST_US_GCP_ACCOUNT__PROJECT", "dashwave")
+	store := NewEnvStore("TEST_")
+
+	secret, err := store.GetMap(ctx, "US-GCP-ACCOUNT")
+	assert.NoError(t, err)
+	assert.Equal(t, VaultSecretMap{"GCP_CREDENTIALS_JSON": "{}", "PROJECT": "dashwave"}, secret)
+
+	assert.NoError(t, store.Put(ctx, "US-GCP-ACCOUNT", VaultSecretMap{"PROJECT": "other"}))
+	_, ok := os.LookupEnv("TEST_US_GCP_ACCOUNT__GCP_CREDENTIALS_JSON")
+	assert.False(t, ok)
+	value, err := store.Get(ctx, "US-GCP-ACCOUNT", "PROJECT")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", value)
+
+	paths, err := store.List(ctx, "US")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"US_GCP_ACCOUNT"}, paths)
+
+	assert.NoError(t, store.Delete(ctx, "US-GCP-ACCOUNT"))
+	_, err = store.GetMap(ctx, "US-GCP-ACCOUNT")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	files := map[string]string{
+		"secrets.env":  "# local secrets\nS3__AWS_ACCESS_KEY_ID=AKIA\nexport S3__AWS_SECRET_ACCESS_KEY=\"se cret\"\n",
+		"secrets.json": `{"S3": {"AWS_ACCESS_KEY_ID": "AKIA", "AWS_SECRET_ACCESS_KEY": "se cret"}}`,
+		"secrets.yaml": "S3:\n  AWS_ACCESS_KEY_ID: AKIA\n  AWS_SECRET_ACCESS_KEY: se cret\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), name)
+			assert.NoError(t, os.WriteFile(filename, []byte(content), 0600))
+
+			store, err := NewFileStore(filename)
+			assert.NoError(t, err)
+			value, err := store.Get(ctx, "S3", "AWS_SECRET_ACCESS_KEY")
+			assert.NoError(t, err)
+			assert.Equal(t, "se cret", value)
+
+			assert.NoError(t, store.Put(ctx, "GCP", VaultSecretMap{"PROJECT": "dashwave"}))
+			reloaded, err := NewFileStore(filename)
+			assert.NoError(t, err)
+			paths, err := reloaded.List(ctx, "")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"GCP", "S3"}, paths)
+			value, err = reloaded.Get(ctx, "GCP", "PROJECT")
+			assert.NoError(t, err)
+			assert.Equal(t, "dashwave", value)
+		})
+	}
+
+	_, err := NewFileStore(filepath.Join(t.TempDir(), "missing.env"))
+	assert.Error(t, err)
+}
+
+func TestChainStore(t *testing.T) {
+	ctx := context.Background()
+	kv, vc := newFakeKV(t)
+	kv.put(DEFAULT_KV_STORE, "S3", map[string]interface{}{"AWS_ACCESS_KEY_ID": "vault", "AWS_REGION": "ap-south-1"})
+
+	local := NewMemoryStore(map[string]VaultSecretMap{"S3": {"AWS_ACCESS_KEY_ID": "local"}})
+	chain := NewChainStore(local, vc)
+
+	value, err := chain.Get(ctx, "S3", "AWS_ACCESS_KEY_ID")
+	assert.NoError(t, err)
+	assert.Equal(t, "local", value)
+
+	// Keys missing from the first store fall through to Vault
+	value, err = chain.Get(ctx, "S3", "AWS_REGION")
+	assert.NoError(t, err)
+	assert.Equal(t, "ap-south-1", value)
+
+	_, err = chain.GetMap(ctx, "missing")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+
+	paths, err := chain.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"S3"}, paths)
+
+	// Writes only go to the first store
+	assert.NoError(t, chain.Put(ctx, "GCP", VaultSecretMap{"PROJECT": "dashwave"}))
+	_, err = vc.GetMap(ctx, "GCP")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+
+	// Selecting a KV store narrows down Vault and keeps the other stores
+	kv.put("aws-credentials", "US-ACCOUNT", map[string]interface{}{"AWS_ACCESS_KEY_ID": "us", "AWS_REGION": "us-east-1"})
+	selected := chain.SelectStore("aws-credentials")
+	value, err = selected.Get(ctx, "US-ACCOUNT", "AWS_ACCESS_KEY_ID")
+	assert.NoError(t, err)
+	assert.Equal(t, "us", value)
+	value, err = selected.Get(ctx, "S3", "AWS_ACCESS_KEY_ID")
+	assert.NoError(t, err)
+	assert.Equal(t, "local", value)
+	_, err = selected.Get(ctx, "S3", "AWS_REGION")
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+}
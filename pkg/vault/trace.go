@@ -0,0 +1,41 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+
+	vault "github.com/hashicorp/vault/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/dashwave/sharedlib/pkg/vault"
+
+// startSpan starts a span for a Vault operation on the secret at secretPath
+// in kvStore. It uses the global tracer provider, so it is a no-op until the
+// tracer has been initialised.
+func startSpan(ctx context.Context, name, kvStore, secretPath string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(
+		attribute.String("vault.store", kvStore),
+		attribute.String("vault.path", secretPath),
+	))
+}
+
+// client returns the Vault client to issue a request for ctx with. The trace
+// context of ctx is injected into the headers of every request it sends, and
+// callbacks are run on every request after that.
+func (vc *VaultClient) client(ctx context.Context, callbacks ...vault.RequestCallback) *vault.Client {
+	inject := func(r *vault.Request) {
+		if r.Headers == nil {
+			r.Headers = http.Header{}
+		}
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Headers))
+	}
+	// WithRequestCallbacks copies the client without locking it, so it must
+	// not run while the token is being replaced by a login
+	vc.tokenMu.RLock()
+	defer vc.tokenMu.RUnlock()
+	return vc.Cli.WithRequestCallbacks(append([]vault.RequestCallback{inject}, callbacks...)...)
+}
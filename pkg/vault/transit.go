@@ -0,0 +1,428 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+const DEFAULT_TRANSIT_MOUNT = "transit"
+
+// Transit performs cryptographic operations with a named key of the Vault
+// transit engine, so the key material never leaves Vault.
+type Transit struct {
+	vc        *VaultClient
+	mountPath string
+	keyName   string
+}
+
+// TransitOption sets an optional parameter of a transit request.
+type TransitOption func(params map[string]interface{})
+
+// WithKeyVersion pins the key version used to encrypt, sign or HMAC instead
+// of the latest one.
+func WithKeyVersion(version int) TransitOption {
+	return func(params map[string]interface{}) {
+		params["key_version"] = version
+	}
+}
+
+// WithDerivationContext sets the context used to derive the key when the
+// transit key was created with derivation enabled.
+func WithDerivationContext(derivationContext []byte) TransitOption {
+	return func(params map[string]interface{}) {
+		params["context"] = base64.StdEncoding.EncodeToString(derivationContext)
+	}
+}
+
+// WithHashAlgorithm sets the hash algorithm used to sign, verify or HMAC,
+// e.g. "sha2-256" or "sha2-512".
+func WithHashAlgorithm(algorithm string) TransitOption {
+	return func(params map[string]interface{}) {
+		params["hash_algorithm"] = algorithm
+	}
+}
+
+// TransitBatchItem is a single input of a batch request. Plaintext is used by
+// EncryptBatch, Ciphertext by DecryptBatch and RewrapBatch.
+type TransitBatchItem struct {
+	Plaintext  []byte
+	Ciphertext string
+	Context    []byte
+	KeyVersion int
+}
+
+// TransitBatchResult is the result of a single batch item, in the order the
+// items were given. Err is set when only that item failed.
+type TransitBatchResult struct {
+	Plaintext  []byte
+	Ciphertext string
+	KeyVersion int
+	Err        error
+}
+
+// DataKey is a data key generated by the transit engine. Plaintext is only
+// set when it was requested and must be discarded after use; Ciphertext can
+// be stored next to the data and decrypted with the transit key later.
+type DataKey struct {
+	Plaintext  []byte
+	Ciphertext string
+	KeyVersion int
+}
+
+// TransitKeyInfo describes the versions of a transit key.
+type TransitKeyInfo struct {
+	Name                 string
+	Type                 string
+	LatestVersion        int
+	MinDecryptionVersion int
+	MinEncryptionVersion int
+	SupportsEncryption   bool
+	SupportsDecryption   bool
+	SupportsSigning      bool
+	SupportsDerivation   bool
+}
+
+// NewTransit returns a Transit client for keyName in the transit engine
+// mounted at mountPath, which defaults to DEFAULT_TRANSIT_MOUNT.
+func NewTransit(vc *VaultClient, mountPath, keyName string) *Transit {
+	return &Transit{vc: vc, mountPath: mountOrDefault(mountPath, DEFAULT_TRANSIT_MOUNT), keyName: keyName}
+}
+
+// Encrypt encrypts plaintext and returns the ciphertext, prefixed with the
+// key version as "vault:v<N>:".
+func (t *Transit) Encrypt(ctx context.Context, plaintext []byte, opts ...TransitOption) (string, error) {
+	params := transitParams(opts)
+	params["plaintext"] = base64.StdEncoding.EncodeToString(plaintext)
+
+	secret, err := t.write(ctx, "encrypt", params)
+	if err != nil {
+		return "", err
+	}
+	return stringField(secret.Data, "ciphertext")
+}
+
+// Decrypt decrypts a ciphertext returned by Encrypt.
+func (t *Transit) Decrypt(ctx context.Context, ciphertext string, opts ...TransitOption) ([]byte, error) {
+	params := transitParams(opts)
+	params["ciphertext"] = ciphertext
+
+	secret, err := t.write(ctx, "decrypt", params)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := stringField(secret.Data, "plaintext")
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(plaintext)
+}
+
+// Rewrap re-encrypts ciphertext with the latest version of the key, or the
+// version given with WithKeyVersion, without exposing the plaintext.
+func (t *Transit) Rewrap(ctx context.Context, ciphertext string, opts ...TransitOption) (string, error) {
+	params := transitParams(opts)
+	params["ciphertext"] = ciphertext
+
+	secret, err := t.write(ctx, "rewrap", params)
+	if err != nil {
+		return "", err
+	}
+	return stringField(secret.Data, "ciphertext")
+}
+
+// EncryptBatch encrypts the Plaintext of every item in a single request.
+func (t *Transit) EncryptBatch(ctx context.Context, items []TransitBatchItem) ([]TransitBatchResult, error) {
+	return t.batch(ctx, "encrypt", items, func(item TransitBatchItem) map[string]interface{} {
+		return map[string]interface{}{"plaintext": base64.StdEncoding.EncodeToString(item.Plaintext)}
+	})
+}
+
+// DecryptBatch decrypts the Ciphertext of every item in a single request.
+func (t *Transit) DecryptBatch(ctx context.Context, items []TransitBatchItem) ([]TransitBatchResult, error) {
+	return t.batch(ctx, "decrypt", items, func(item TransitBatchItem) map[string]interface{} {
+		return map[string]interface{}{"ciphertext": item.Ciphertext}
+	})
+}
+
+// RewrapBatch rewraps the Ciphertext of every item in a single request.
+func (t *Transit) RewrapBatch(ctx context.Context, items []TransitBatchItem) ([]TransitBatchResult, error) {
+	return t.batch(ctx, "rewrap", items, func(item TransitBatchItem) map[string]interface{} {
+		return map[string]interface{}{"ciphertext": item.Ciphertext}
+	})
+}
+
+// GenerateDataKey generates a new data key of the given bit size (128, 256
+// or 512) encrypted with the transit key. The plaintext key is only returned
+// when withPlaintext is set.
+func (t *Transit) GenerateDataKey(ctx context.Context, bits int, withPlaintext bool, opts ...TransitOption) (*DataKey, error) {
+	keyType := "wrapped"
+	if withPlaintext {
+		keyType = "plaintext"
+	}
+	params := transitParams(opts)
+	params["bits"] = bits
+
+	secret, err := t.write(ctx, "datakey/"+keyType, params)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &DataKey{KeyVersion: intField(secret.Data, "key_version")}
+	if key.Ciphertext, err = stringField(secret.Data, "ciphertext"); err != nil {
+		return nil, err
+	}
+	if withPlaintext {
+		plaintext, err := stringField(secret.Data, "plaintext")
+		if err != nil {
+			return nil, err
+		}
+		if key.Plaintext, err = base64.StdEncoding.DecodeString(plaintext); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Sign signs input with the transit key, which must support signing.
+func (t *Transit) Sign(ctx context.Context, input []byte, opts ...TransitOption) (string, error) {
+	params := transitParams(opts)
+	params["input"] = base64.StdEncoding.EncodeToString(input)
+
+	secret, err := t.write(ctx, "sign", params)
+	if err != nil {
+		return "", err
+	}
+	return stringField(secret.Data, "signature")
+}
+
+// Verify reports whether signature is a valid signature of input.
+func (t *Transit) Verify(ctx context.Context, input []byte, signature string, opts ...TransitOption) (bool, error) {
+	params := transitParams(opts)
+	params["input"] = base64.StdEncoding.EncodeToString(input)
+	params["signature"] = signature
+
+	secret, err := t.write(ctx, "verify", params)
+	if err != nil {
+		return false, err
+	}
+	valid, _ := secret.Data["valid"].(bool)
+	return valid, nil
+}
+
+// HMAC returns the HMAC of input computed with the transit key.
+func (t *Transit) HMAC(ctx context.Context, input []byte, opts ...TransitOption) (string, error) {
+	params := transitParams(opts)
+	params["input"] = base64.StdEncoding.EncodeToString(input)
+
+	secret, err := t.write(ctx, "hmac", params)
+	if err != nil {
+		return "", err
+	}
+	return stringField(secret.Data, "hmac")
+}
+
+// VerifyHMAC reports whether hmac is a valid HMAC of input.
+func (t *Transit) VerifyHMAC(ctx context.Context, input []byte, hmac string, opts ...TransitOption) (bool, error) {
+	params := transitParams(opts)
+	params["input"] = base64.StdEncoding.EncodeToString(input)
+	params["hmac"] = hmac
+
+	secret, err := t.write(ctx, "verify", params)
+	if err != nil {
+		return false, err
+	}
+	valid, _ := secret.Data["valid"].(bool)
+	return valid, nil
+}
+
+// ReadKey returns the version information of the transit key.
+func (t *Transit) ReadKey(ctx context.Context) (*TransitKeyInfo, error) {
+	ctx, span := startSpan(ctx, "vault.Transit.ReadKey", t.mountPath, t.keyName)
+	defer span.End()
+
+	secret, err := t.vc.client(ctx).Logical().ReadWithContext(ctx, fmt.Sprintf("%s/keys/%s", t.mountPath, t.keyName))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("unable to read transit key %s: %v", t.keyName, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("transit key %s not found", t.keyName)
+	}
+
+	name, _ := secret.Data["name"].(string)
+	keyType, _ := secret.Data["type"].(string)
+	info := &TransitKeyInfo{
+		Name:                 name,
+		Type:                 keyType,
+		LatestVersion:        intField(secret.Data, "latest_version"),
+		MinDecryptionVersion: intField(secret.Data, "min_decryption_version"),
+		MinEncryptionVersion: intField(secret.Data, "min_encryption_version"),
+	}
+	info.SupportsEncryption, _ = secret.Data["supports_encryption"].(bool)
+	info.SupportsDecryption, _ = secret.Data["supports_decryption"].(bool)
+	info.SupportsSigning, _ = secret.Data["supports_signing"].(bool)
+	info.SupportsDerivation, _ = secret.Data["supports_derivation"].(bool)
+	return info, nil
+}
+
+// RotateKey creates a new version of the transit key, which becomes the
+// version used to encrypt from then on.
+func (t *Transit) RotateKey(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "vault.Transit.RotateKey", t.mountPath, t.keyName)
+	defer span.End()
+
+	_, err := t.vc.client(ctx).Logical().WriteWithContext(ctx, fmt.Sprintf("%s/keys/%s/rotate", t.mountPath, t.keyName), nil)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("unable to rotate transit key %s: %v", t.keyName, err)
+	}
+	return nil
+}
+
+// CiphertextKeyVersion returns the key version a transit ciphertext was
+// encrypted with, parsed from its "vault:v<N>:" prefix.
+func CiphertextKeyVersion(ciphertext string) (int, error) {
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" || !strings.HasPrefix(parts[1], "v") {
+		return 0, fmt.Errorf("invalid transit ciphertext")
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(parts[1], "v"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid transit ciphertext key version: %v", err)
+	}
+	return version, nil
+}
+
+func (t *Transit) batch(ctx context.Context, operation string, items []TransitBatchItem, input func(TransitBatchItem) map[string]interface{}) ([]TransitBatchResult, error) {
+	batchInput := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		params := input(item)
+		if len(item.Context) > 0 {
+			params["context"] = base64.StdEncoding.EncodeToString(item.Context)
+		}
+		if item.KeyVersion > 0 {
+			params["key_version"] = item.KeyVersion
+		}
+		batchInput[i] = params
+	}
+
+	secret, err := t.writeBatch(ctx, operation, batchInput)
+	if err != nil {
+		return nil, err
+	}
+
+	rawResults, _ := secret.Data["batch_results"].([]interface{})
+	if len(rawResults) != len(items) {
+		return nil, fmt.Errorf("transit %s returned %d results for %d items", operation, len(rawResults), len(items))
+	}
+	results := make([]TransitBatchResult, len(rawResults))
+	for i, raw := range rawResults {
+		data, _ := raw.(map[string]interface{})
+		if msg, _ := data["error"].(string); msg != "" {
+			results[i].Err = fmt.Errorf("transit %s failed: %s", operation, msg)
+			continue
+		}
+		results[i].Ciphertext, _ = data["ciphertext"].(string)
+		results[i].KeyVersion = intField(data, "key_version")
+		if plaintext, ok := data["plaintext"].(string); ok {
+			if results[i].Plaintext, err = base64.StdEncoding.DecodeString(plaintext); err != nil {
+				results[i].Err = err
+			}
+		}
+	}
+	return results, nil
+}
+
+func (t *Transit) write(ctx context.Context, operation string, params map[string]interface{}) (*vault.Secret, error) {
+	ctx, span := startSpan(ctx, "vault.Transit."+operation, t.mountPath, t.keyName)
+	defer span.End()
+
+	path := fmt.Sprintf("%s/%s/%s", t.mountPath, operation, t.keyName)
+	secret, err := t.vc.client(ctx).Logical().WriteWithContext(ctx, path, params)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("unable to %s with transit key %s: %v", operation, t.keyName, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("no data returned by transit %s", operation)
+	}
+	return secret, nil
+}
+
+// writeBatch sends a batch request. Vault answers 400 when only some of the
+// items failed, unless it supports partial_failure_response_code, and the
+// results of every item are then in the body of the error response, which
+// Logical().Write discards.
+func (t *Transit) writeBatch(ctx context.Context, operation string, batchInput []map[string]interface{}) (*vault.Secret, error) {
+	ctx, span := startSpan(ctx, "vault.Transit."+operation, t.mountPath, t.keyName)
+	defer span.End()
+
+	client := t.vc.client(ctx)
+	req := client.NewRequest(http.MethodPut, fmt.Sprintf("/v1/%s/%s/%s", t.mountPath, operation, t.keyName))
+	if err := req.SetJSONBody(map[string]interface{}{
+		"batch_input":                   batchInput,
+		"partial_failure_response_code": http.StatusOK,
+	}); err != nil {
+		return nil, fmt.Errorf("unable to encode transit %s request: %v", operation, err)
+	}
+
+	resp, err := client.RawRequestWithContext(ctx, req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == http.StatusBadRequest {
+		if secret, parseErr := vault.ParseSecret(resp.Body); parseErr == nil && secret != nil && secret.Data["batch_results"] != nil {
+			return secret, nil
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("unable to %s with transit key %s: %v", operation, t.keyName, err)
+	}
+
+	secret, err := vault.ParseSecret(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode transit %s response: %v", operation, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("no data returned by transit %s", operation)
+	}
+	return secret, nil
+}
+
+func transitParams(opts []TransitOption) map[string]interface{} {
+	params := map[string]interface{}{}
+	for _, opt := range opts {
+		opt(params)
+	}
+	return params
+}
+
+func stringField(data map[string]interface{}, key string) (string, error) {
+	value, ok := data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("value type assertion failed for %s: %T %#v", key, data[key], data[key])
+	}
+	return value, nil
+}
+
+// intField reads a number Vault returned as a json.Number, 0 when missing.
+func intField(data map[string]interface{}, key string) int {
+	switch v := data[key].(type) {
+	case json.Number:
+		n, _ := v.Int64()
+		return int(n)
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,174 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTransit "encrypts" by prefixing the base64 plaintext with the key
+// version, and signs and HMACs the same way, which is enough to check the
+// request and response plumbing.
+func fakeTransit(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	operation := strings.TrimPrefix(r.URL.Path, "/v1/transit/")
+	operation = operation[:strings.LastIndex(operation, "/")]
+	transform := func(item map[string]interface{}) map[string]interface{} {
+		switch operation {
+		case "encrypt":
+			return map[string]interface{}{"ciphertext": "vault:v2:" + item["plaintext"].(string), "key_version": 2}
+		case "decrypt", "rewrap":
+			ciphertext := item["ciphertext"].(string)
+			if !strings.HasPrefix(ciphertext, "vault:v") {
+				return map[string]interface{}{"error": "invalid ciphertext"}
+			}
+			if operation == "rewrap" {
+				return map[string]interface{}{"ciphertext": "vault:v2:" + strings.SplitN(ciphertext, ":", 3)[2], "key_version": 2}
+			}
+			return map[string]interface{}{"plaintext": strings.SplitN(ciphertext, ":", 3)[2]}
+		case "sign":
+			algorithm, _ := item["hash_algorithm"].(string)
+			return map[string]interface{}{"signature": "vault:v1:" + algorithm + ":" + item["input"].(string)}
+		case "hmac":
+			return map[string]interface{}{"hmac": "vault:v1:hmac:" + item["input"].(string)}
+		case "verify":
+			if hmac, ok := item["hmac"].(string); ok {
+				return map[string]interface{}{"valid": hmac == "vault:v1:hmac:"+item["input"].(string)}
+			}
+			algorithm, _ := item["hash_algorithm"].(string)
+			return map[string]interface{}{"valid": item["signature"] == "vault:v1:"+algorithm+":"+item["input"].(string)}
+		case "datakey/plaintext", "datakey/wrapped":
+			key := strings.Repeat("k", int(item["bits"].(float64))/8)
+			data := map[string]interface{}{"ciphertext": "vault:v3:" + base64.StdEncoding.EncodeToString([]byte(key)), "key_version": 3}
+			if operation == "datakey/plaintext" {
+				data["plaintext"] = base64.StdEncoding.EncodeToString([]byte(key))
+			}
+			return data
+		}
+		return nil
+	}
+
+	if batch, ok := body["batch_input"].([]interface{}); ok {
+		// Like Vault before partial_failure_response_code, a batch with a
+		// failed item is answered with a 400 holding every result
+		results := make([]interface{}, len(batch))
+		status := http.StatusOK
+		for i, item := range batch {
+			result := transform(item.(map[string]interface{}))
+			if result["error"] != nil {
+				status = http.StatusBadRequest
+			}
+			results[i] = result
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"batch_results": results}})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"data": transform(body)})
+}
+
+func newTestTransit(t *testing.T) *Transit {
+	server := httptest.NewServer(http.HandlerFunc(fakeTransit))
+	t.Cleanup(server.Close)
+	vc, err := New(WithAddress(server.URL), WithToken("token"), WithRetry(0, 0, 0))
+	assert.NoError(t, err)
+	return NewTransit(vc, "", "scm")
+}
+
+func TestTransit(t *testing.T) {
+	ctx := context.Background()
+	transit := newTestTransit(t)
+
+	ciphertext, err := transit.Encrypt(ctx, []byte("github-token"))
+	assert.NoError(t, err)
+	version, err := CiphertextKeyVersion(ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	plaintext, err := transit.Decrypt(ctx, ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, "github-token", string(plaintext))
+
+	results, err := transit.DecryptBatch(ctx, []TransitBatchItem{{Ciphertext: ciphertext}, {Ciphertext: "garbage"}})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, "github-token", string(results[0].Plaintext))
+		assert.Error(t, results[1].Err)
+	}
+
+	results, err = transit.EncryptBatch(ctx, []TransitBatchItem{{Plaintext: []byte("a")}, {Plaintext: []byte("b")}})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "vault:v2:"+base64.StdEncoding.EncodeToString([]byte("b")), results[1].Ciphertext)
+		assert.Equal(t, 2, results[1].KeyVersion)
+	}
+}
+
+func TestTransitRewrap(t *testing.T) {
+	ctx := context.Background()
+	transit := newTestTransit(t)
+
+	rewrapped, err := transit.Rewrap(ctx, "vault:v1:Z2l0aHVi")
+	assert.NoError(t, err)
+	assert.Equal(t, "vault:v2:Z2l0aHVi", rewrapped)
+
+	results, err := transit.RewrapBatch(ctx, []TransitBatchItem{{Ciphertext: "garbage"}, {Ciphertext: "vault:v1:Z2l0aHVi"}})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		assert.Error(t, results[0].Err)
+		assert.Equal(t, "vault:v2:Z2l0aHVi", results[1].Ciphertext)
+		assert.Equal(t, 2, results[1].KeyVersion)
+	}
+}
+
+func TestTransitSignAndHMAC(t *testing.T) {
+	ctx := context.Background()
+	transit := newTestTransit(t)
+	input := []byte("release-manifest")
+
+	signature, err := transit.Sign(ctx, input, WithHashAlgorithm("sha2-512"))
+	assert.NoError(t, err)
+	assert.Equal(t, "vault:v1:sha2-512:"+base64.StdEncoding.EncodeToString(input), signature)
+	valid, err := transit.Verify(ctx, input, signature, WithHashAlgorithm("sha2-512"))
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	valid, err = transit.Verify(ctx, []byte("tampered"), signature, WithHashAlgorithm("sha2-512"))
+	assert.NoError(t, err)
+	assert.False(t, valid)
+
+	hmac, err := transit.HMAC(ctx, input)
+	assert.NoError(t, err)
+	assert.Equal(t, "vault:v1:hmac:"+base64.StdEncoding.EncodeToString(input), hmac)
+	valid, err = transit.VerifyHMAC(ctx, input, hmac)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	valid, err = transit.VerifyHMAC(ctx, []byte("tampered"), hmac)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+}
+
+func TestTransitGenerateDataKey(t *testing.T) {
+	ctx := context.Background()
+	transit := newTestTransit(t)
+
+	key, err := transit.GenerateDataKey(ctx, 256, true)
+	assert.NoError(t, err)
+	assert.Len(t, key.Plaintext, 32)
+	assert.Equal(t, 3, key.KeyVersion)
+	assert.True(t, strings.HasPrefix(key.Ciphertext, "vault:v3:"))
+
+	key, err = transit.GenerateDataKey(ctx, 128, false)
+	assert.NoError(t, err)
+	assert.Nil(t, key.Plaintext)
+	assert.True(t, strings.HasPrefix(key.Ciphertext, "vault:v3:"))
+}
@@ -0,0 +1,247 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dashwave/sharedlib/pkg/encrypt"
+	vault "github.com/hashicorp/vault/api"
+)
+
+type DiffAction string
+
+const (
+	SECRET_CREATE    DiffAction = "CREATE"
+	SECRET_UPDATE    DiffAction = "UPDATE"
+	SECRET_UNCHANGED DiffAction = "UNCHANGED"
+)
+
+// SecretExport is a portable copy of every secret under Prefix in Store.
+// Secrets are keyed by their path in the store.
+type SecretExport struct {
+	Store      string                    `json:"store"`
+	Prefix     string                    `json:"prefix"`
+	ExportedAt time.Time                 `json:"exported_at"`
+	Secrets    map[string]VaultSecretMap `json:"secrets"`
+}
+
+// encryptedExport is the envelope an export is written in when it is
+// encrypted. Data holds the hex encoded output of encrypt.Encrypt.
+type encryptedExport struct {
+	Encrypted bool   `json:"encrypted"`
+	Data      string `json:"data"`
+}
+
+// SecretDiff describes what importing a secret changes. Only key names are
+// reported, never values.
+type SecretDiff struct {
+	Path    string
+	Action  DiffAction
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+// ListSecrets returns the paths of the secrets under prefix in kvStore. When
+// recursive is false the direct children are returned, with folders ending
+// in "/". When recursive is true every folder is walked and only secret paths
+// are returned. Paths are relative to the store and sorted.
+func (vc *VaultClient) ListSecrets(ctx context.Context, kvStore, prefix string, recursive bool) ([]string, error) {
+	ctx, span := startSpan(ctx, "vault.ListSecrets", kvStore, prefix)
+	defer span.End()
+
+	prefix = strings.TrimPrefix(prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var paths []string
+	folders := []string{prefix}
+	for len(folders) > 0 {
+		folder := folders[0]
+		folders = folders[1:]
+
+		keys, err := vc.listFolder(ctx, kvStore, folder)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		for _, key := range keys {
+			path := folder + key
+			if recursive && strings.HasSuffix(key, "/") {
+				folders = append(folders, path)
+				continue
+			}
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (vc *VaultClient) listFolder(ctx context.Context, kvStore, folder string) ([]string, error) {
+	secret, err := vc.client(ctx).Logical().ListWithContext(ctx, fmt.Sprintf("%s/metadata/%s", kvStore, folder))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list secrets under %q: %v", folder, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+	rawKeys, _ := secret.Data["keys"].([]interface{})
+	keys := make([]string, 0, len(rawKeys))
+	for _, k := range rawKeys {
+		if key, ok := k.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// ExportSecrets reads the latest version of every secret under prefix in
+// kvStore into a SecretExport.
+func (vc *VaultClient) ExportSecrets(ctx context.Context, kvStore, prefix string) (*SecretExport, error) {
+	paths, err := vc.ListSecrets(ctx, kvStore, prefix, true)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &SecretExport{
+		Store:      kvStore,
+		Prefix:     prefix,
+		ExportedAt: time.Now().UTC(),
+		Secrets:    make(map[string]VaultSecretMap, len(paths)),
+	}
+	for _, path := range paths {
+		secret, err := vc.readSecret(ctx, kvStore, path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to export %q: %v", path, err)
+		}
+		export.Secrets[path] = secret
+	}
+	return export, nil
+}
+
+// ImportSecrets writes every secret of export into kvStore at the same path
+// and returns what changed for each of them. Secrets whose data is identical
+// are left untouched, and nothing is written when dryRun is set. Secrets in
+// kvStore that are missing from export are not deleted.
+func (vc *VaultClient) ImportSecrets(ctx context.Context, kvStore string, export *SecretExport, dryRun bool) ([]SecretDiff, error) {
+	paths := make([]string, 0, len(export.Secrets))
+	for path := range export.Secrets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	diffs := make([]SecretDiff, 0, len(paths))
+	for _, path := range paths {
+		desired := export.Secrets[path]
+
+		var current VaultSecretMap
+		secret, err := vc.client(ctx).KVv2(kvStore).Get(ctx, path)
+		switch {
+		case errors.Is(err, vault.ErrSecretNotFound):
+		case err != nil:
+			return diffs, fmt.Errorf("unable to read %q: %v", path, err)
+		default:
+			current = secret.Data
+		}
+
+		diff := diffSecret(path, current, desired)
+		if !dryRun && diff.Action != SECRET_UNCHANGED {
+			if _, err := vc.PutSecretMap(ctx, kvStore, path, desired); err != nil {
+				return diffs, fmt.Errorf("unable to import %q: %v", path, err)
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+func diffSecret(path string, current, desired VaultSecretMap) SecretDiff {
+	diff := SecretDiff{Path: path, Action: SECRET_UNCHANGED}
+	if current == nil {
+		diff.Action = SECRET_CREATE
+	}
+	for key, value := range desired {
+		old, ok := current[key]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, key)
+		case !sameValue(old, value):
+			diff.Changed = append(diff.Changed, key)
+		}
+	}
+	for key := range current {
+		if _, ok := desired[key]; !ok {
+			diff.Removed = append(diff.Removed, key)
+		}
+	}
+	if diff.Action == SECRET_UNCHANGED && len(diff.Added)+len(diff.Changed)+len(diff.Removed) > 0 {
+		diff.Action = SECRET_UPDATE
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Changed)
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+// sameValue compares values by their JSON form, since numbers read from
+// Vault and from an export file decode to different Go types.
+func sameValue(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// MarshalSecretExport encodes export as JSON. When encryptionKey is set the
+// document is encrypted with encrypt.Encrypt, so the key must be 16, 24 or
+// 32 bytes long.
+func MarshalSecretExport(export *SecretExport, encryptionKey string) ([]byte, error) {
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if encryptionKey == "" {
+		return data, nil
+	}
+
+	ciphertext, err := encrypt.Encrypt(string(data), encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encrypt secret export: %v", err)
+	}
+	return json.MarshalIndent(encryptedExport{Encrypted: true, Data: ciphertext}, "", "  ")
+}
+
+// UnmarshalSecretExport decodes a document written by MarshalSecretExport. The
+// encryptionKey is required when the document is encrypted.
+func UnmarshalSecretExport(data []byte, encryptionKey string) (*SecretExport, error) {
+	var envelope encryptedExport
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("unable to decode secret export: %v", err)
+	}
+	if envelope.Encrypted {
+		if encryptionKey == "" {
+			return nil, fmt.Errorf("secret export is encrypted but no key was provided")
+		}
+		plaintext, err := encrypt.Decrypt(envelope.Data, encryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt secret export: %v", err)
+		}
+		data = []byte(plaintext)
+	}
+
+	export := &SecretExport{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(export); err != nil {
+		return nil, fmt.Errorf("unable to decode secret export: %v", err)
+	}
+	return export, nil
+}
@@ -0,0 +1,76 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListExportImportSecrets(t *testing.T) {
+	kv, vc := newFakeKV(t)
+	ctx := context.Background()
+	kv.put(INTERNAL_SERVICES_STORE, BUILD_RUNNER_SECRET_PATH, map[string]interface{}{BR_ACCESS_ENCRYPTION_KEY: "key"})
+	kv.put(INTERNAL_SERVICES_STORE, "scm/github", map[string]interface{}{"TOKEN": "gh"})
+	kv.put(INTERNAL_SERVICES_STORE, "scm/gitlab/app", map[string]interface{}{"TOKEN": "gl", "PORT": 8080})
+
+	paths, err := vc.ListSecrets(ctx, INTERNAL_SERVICES_STORE, "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BUILD_RUNNER_SECRET_PATH, "scm/"}, paths)
+
+	paths, err = vc.ListSecrets(ctx, INTERNAL_SERVICES_STORE, "scm", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"scm/github", "scm/gitlab/app"}, paths)
+
+	export, err := vc.ExportSecrets(ctx, INTERNAL_SERVICES_STORE, "scm")
+	assert.NoError(t, err)
+	assert.Len(t, export.Secrets, 2)
+
+	key := "0123456789abcdef0123456789abcdef"
+	data, err := MarshalSecretExport(export, key)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "gitlab")
+	_, err = UnmarshalSecretExport(data, "")
+	assert.Error(t, err)
+	export, err = UnmarshalSecretExport(data, key)
+	assert.NoError(t, err)
+
+	kv.put("staging", "scm/github", map[string]interface{}{"TOKEN": "old", "EXTRA": "x"})
+
+	diffs, err := vc.ImportSecrets(ctx, "staging", export, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []SecretDiff{
+		{Path: "scm/github", Action: SECRET_UPDATE, Changed: []string{"TOKEN"}, Removed: []string{"EXTRA"}},
+		{Path: "scm/gitlab/app", Action: SECRET_CREATE, Added: []string{"PORT", "TOKEN"}},
+	}, diffs)
+	paths, err = vc.ListSecrets(ctx, "staging", "", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"scm/github"}, paths)
+
+	_, err = vc.ImportSecrets(ctx, "staging", export, false)
+	assert.NoError(t, err)
+	diffs, err = vc.ImportSecrets(ctx, "staging", export, true)
+	assert.NoError(t, err)
+	for _, diff := range diffs {
+		assert.Equal(t, SECRET_UNCHANGED, diff.Action)
+	}
+
+	secret, err := vc.GetSecretMapByStoreCtx(ctx, "scm/gitlab/app", "staging")
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("8080"), secret["PORT"])
+}
+
+func TestUnmarshalMalformedSecretExport(t *testing.T) {
+	key := "0123456789abcdef0123456789abcdef"
+	for _, data := range []string{
+		`{"encrypted": true, "data": ""}`,
+		`{"encrypted": true, "data": "0102"}`,
+		`{"encrypted": true, "data": "` + strings.Repeat("zz", 40) + `"}`,
+		`{"encrypted": true, "data": "` + strings.Repeat("00", 40) + `"}`,
+	} {
+		_, err := UnmarshalSecretExport([]byte(data), key)
+		assert.Error(t, err, data)
+	}
+}
@@ -0,0 +1,224 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// SecretVersion describes a single version of a KVv2 secret. DeletionTime is
+// zero unless the version was soft-deleted.
+type SecretVersion struct {
+	Version      int
+	CreatedTime  time.Time
+	DeletionTime time.Time
+	Destroyed    bool
+}
+
+// SecretMetadata describes a KVv2 secret and all of its versions, sorted by
+// version number.
+type SecretMetadata struct {
+	CurrentVersion     int
+	OldestVersion      int
+	MaxVersions        int
+	CASRequired        bool
+	DeleteVersionAfter time.Duration
+	CustomMetadata     map[string]interface{}
+	CreatedTime        time.Time
+	UpdatedTime        time.Time
+	Versions           []SecretVersion
+}
+
+// SecretMetadataUpdate holds the metadata fields to change on a secret. Nil
+// fields are left untouched, CustomMetadata keys set to nil are removed.
+type SecretMetadataUpdate struct {
+	MaxVersions        *int
+	CASRequired        *bool
+	DeleteVersionAfter *time.Duration
+	CustomMetadata     map[string]interface{}
+}
+
+// GetSecretVersion reads the given version of the secret at secretPath in
+// kvStore. Versions are cached when the client has a cache, since their data
+// never changes.
+func (vc *VaultClient) GetSecretVersion(ctx context.Context, kvStore, secretPath string, version int) (VaultSecretMap, error) {
+	fetch := func(ctx context.Context) (VaultSecretMap, error) {
+		ctx, span := startSpan(ctx, "vault.GetSecretVersion", kvStore, secretPath)
+		defer span.End()
+
+		secret, err := vc.client(ctx).KVv2(kvStore).GetVersion(ctx, secretPath, version)
+		if errors.Is(err, vault.ErrSecretNotFound) {
+			return nil, fmt.Errorf("%w: version %d of %s", ErrSecretNotFound, version, secretPath)
+		}
+		if err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("unable to read version %d of secret: %v", version, err)
+		}
+		return secret.Data, nil
+	}
+	if vc.cache != nil {
+		return vc.cache.get(ctx, cacheKey{store: kvStore, path: secretPath, version: version}, fetch)
+	}
+	return fetch(ctx)
+}
+
+// ListSecretVersions returns the metadata of every version of the secret at
+// secretPath in kvStore, sorted by version number.
+func (vc *VaultClient) ListSecretVersions(ctx context.Context, kvStore, secretPath string) ([]SecretVersion, error) {
+	metadata, err := vc.GetSecretMetadata(ctx, kvStore, secretPath)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.Versions, nil
+}
+
+// GetSecretMetadata reads the metadata of the secret at secretPath in kvStore.
+func (vc *VaultClient) GetSecretMetadata(ctx context.Context, kvStore, secretPath string) (*SecretMetadata, error) {
+	ctx, span := startSpan(ctx, "vault.GetSecretMetadata", kvStore, secretPath)
+	defer span.End()
+
+	metadata, err := vc.client(ctx).KVv2(kvStore).GetMetadata(ctx, secretPath)
+	if errors.Is(err, vault.ErrSecretNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, secretPath)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("unable to read secret metadata: %v", err)
+	}
+
+	out := &SecretMetadata{
+		CurrentVersion:     metadata.CurrentVersion,
+		OldestVersion:      metadata.OldestVersion,
+		MaxVersions:        metadata.MaxVersions,
+		CASRequired:        metadata.CASRequired,
+		DeleteVersionAfter: metadata.DeleteVersionAfter,
+		CustomMetadata:     metadata.CustomMetadata,
+		CreatedTime:        metadata.CreatedTime,
+		UpdatedTime:        metadata.UpdatedTime,
+		Versions:           make([]SecretVersion, 0, len(metadata.Versions)),
+	}
+	for _, v := range metadata.Versions {
+		out.Versions = append(out.Versions, SecretVersion{
+			Version:      v.Version,
+			CreatedTime:  v.CreatedTime,
+			DeletionTime: v.DeletionTime,
+			Destroyed:    v.Destroyed,
+		})
+	}
+	sort.Slice(out.Versions, func(i, j int) bool { return out.Versions[i].Version < out.Versions[j].Version })
+	return out, nil
+}
+
+// UpdateSecretMetadata changes the metadata fields set in update on the secret
+// at secretPath in kvStore, creating the metadata if the secret does not
+// exist yet.
+func (vc *VaultClient) UpdateSecretMetadata(ctx context.Context, kvStore, secretPath string, update SecretMetadataUpdate) error {
+	ctx, span := startSpan(ctx, "vault.UpdateSecretMetadata", kvStore, secretPath)
+	defer span.End()
+
+	err := vc.client(ctx).KVv2(kvStore).PatchMetadata(ctx, secretPath, vault.KVMetadataPatchInput{
+		MaxVersions:        update.MaxVersions,
+		CASRequired:        update.CASRequired,
+		DeleteVersionAfter: update.DeleteVersionAfter,
+		CustomMetadata:     update.CustomMetadata,
+	})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("unable to update secret metadata: %v", err)
+	}
+	return nil
+}
+
+// RollbackSecret writes the data of the given version of the secret at
+// secretPath in kvStore as a new version, and returns the new version number.
+func (vc *VaultClient) RollbackSecret(ctx context.Context, kvStore, secretPath string, version int) (int, error) {
+	ctx, span := startSpan(ctx, "vault.RollbackSecret", kvStore, secretPath)
+	defer span.End()
+
+	secret, err := vc.client(ctx).KVv2(kvStore).Rollback(ctx, secretPath, version)
+	vc.InvalidateSecret(kvStore, secretPath)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("unable to roll back secret to version %d: %v", version, err)
+	}
+	return secret.VersionMetadata.Version, nil
+}
+
+// DeleteSecret soft-deletes the latest version of the secret at secretPath in
+// kvStore. It can be restored with UndeleteSecretVersions.
+func (vc *VaultClient) DeleteSecret(ctx context.Context, kvStore, secretPath string) error {
+	ctx, span := startSpan(ctx, "vault.DeleteSecret", kvStore, secretPath)
+	defer span.End()
+
+	err := vc.client(ctx).KVv2(kvStore).Delete(ctx, secretPath)
+	vc.InvalidateSecret(kvStore, secretPath)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("unable to delete secret: %v", err)
+	}
+	return nil
+}
+
+// DeleteSecretVersions soft-deletes the given versions of the secret at
+// secretPath in kvStore.
+func (vc *VaultClient) DeleteSecretVersions(ctx context.Context, kvStore, secretPath string, versions ...int) error {
+	ctx, span := startSpan(ctx, "vault.DeleteSecretVersions", kvStore, secretPath)
+	defer span.End()
+
+	err := vc.client(ctx).KVv2(kvStore).DeleteVersions(ctx, secretPath, versions)
+	vc.InvalidateSecret(kvStore, secretPath)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("unable to delete secret versions %v: %v", versions, err)
+	}
+	return nil
+}
+
+// UndeleteSecretVersions restores soft-deleted versions of the secret at
+// secretPath in kvStore.
+func (vc *VaultClient) UndeleteSecretVersions(ctx context.Context, kvStore, secretPath string, versions ...int) error {
+	ctx, span := startSpan(ctx, "vault.UndeleteSecretVersions", kvStore, secretPath)
+	defer span.End()
+
+	err := vc.client(ctx).KVv2(kvStore).Undelete(ctx, secretPath, versions)
+	vc.InvalidateSecret(kvStore, secretPath)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("unable to undelete secret versions %v: %v", versions, err)
+	}
+	return nil
+}
+
+// DestroySecretVersions permanently removes the data of the given versions of
+// the secret at secretPath in kvStore. Destroyed versions cannot be restored.
+func (vc *VaultClient) DestroySecretVersions(ctx context.Context, kvStore, secretPath string, versions ...int) error {
+	ctx, span := startSpan(ctx, "vault.DestroySecretVersions", kvStore, secretPath)
+	defer span.End()
+
+	err := vc.client(ctx).KVv2(kvStore).Destroy(ctx, secretPath, versions)
+	vc.InvalidateSecret(kvStore, secretPath)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("unable to destroy secret versions %v: %v", versions, err)
+	}
+	return nil
+}
+
+// DestroySecret permanently removes the secret at secretPath in kvStore
+// together with its metadata and every version.
+func (vc *VaultClient) DestroySecret(ctx context.Context, kvStore, secretPath string) error {
+	ctx, span := startSpan(ctx, "vault.DestroySecret", kvStore, secretPath)
+	defer span.End()
+
+	err := vc.client(ctx).KVv2(kvStore).DeleteMetadata(ctx, secretPath)
+	vc.InvalidateSecret(kvStore, secretPath)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("unable to destroy secret: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretVersions(t *testing.T) {
+	kv, vc := newFakeKV(t)
+	ctx := context.Background()
+	kv.put(USER_DATA_STORE, SCM_TOKEN_PATH, map[string]interface{}{SCM_ENCRYPTION_KEY: "old-key"})
+	kv.put(USER_DATA_STORE, SCM_TOKEN_PATH, map[string]interface{}{SCM_ENCRYPTION_KEY: "new-key"})
+
+	secret, err := vc.GetSecretVersion(ctx, USER_DATA_STORE, SCM_TOKEN_PATH, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "old-key", secret[SCM_ENCRYPTION_KEY])
+
+	versions, err := vc.ListSecretVersions(ctx, USER_DATA_STORE, SCM_TOKEN_PATH)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+	assert.Equal(t, 1, versions[0].Version)
+	assert.Equal(t, 2, versions[1].Version)
+	assert.False(t, versions[1].Destroyed)
+	assert.True(t, versions[1].DeletionTime.IsZero())
+
+	version, err := vc.RollbackSecret(ctx, USER_DATA_STORE, SCM_TOKEN_PATH, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+
+	value, err := vc.GetSecretByStoreCtx(ctx, SCM_TOKEN_PATH, SCM_ENCRYPTION_KEY, USER_DATA_STORE)
+	assert.NoError(t, err)
+	assert.Equal(t, "old-key", value)
+}
+
+func TestSecretVersionLifecycle(t *testing.T) {
+	type call struct {
+		method, path string
+		body         map[string]interface{}
+	}
+	var calls []call
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := call{method: r.Method, path: r.URL.Path}
+		json.NewDecoder(r.Body).Decode(&c.body)
+		calls = append(calls, c)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	vc, err := New(WithAddress(server.URL), WithToken("token"), WithRetry(0, 0, 0))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	maxVersions, casRequired, deleteAfter := 5, true, 720*time.Hour
+	assert.NoError(t, vc.DeleteSecret(ctx, USER_DATA_STORE, SCM_TOKEN_PATH))
+	assert.NoError(t, vc.DeleteSecretVersions(ctx, USER_DATA_STORE, SCM_TOKEN_PATH, 1, 2))
+	assert.NoError(t, vc.UndeleteSecretVersions(ctx, USER_DATA_STORE, SCM_TOKEN_PATH, 2))
+	assert.NoError(t, vc.DestroySecretVersions(ctx, USER_DATA_STORE, SCM_TOKEN_PATH, 1))
+	assert.NoError(t, vc.UpdateSecretMetadata(ctx, USER_DATA_STORE, SCM_TOKEN_PATH, SecretMetadataUpdate{
+		MaxVersions:        &maxVersions,
+		CASRequired:        &casRequired,
+		DeleteVersionAfter: &deleteAfter,
+		CustomMetadata:     map[string]interface{}{"owner": "build-runner"},
+	}))
+	assert.NoError(t, vc.DestroySecret(ctx, USER_DATA_STORE, SCM_TOKEN_PATH))
+
+	prefix := "/v1/" + USER_DATA_STORE
+	assert.Equal(t, []call{
+		{method: http.MethodDelete, path: prefix + "/data/" + SCM_TOKEN_PATH},
+		// The Vault API sends the versions to delete as strings
+		{method: http.MethodPut, path: prefix + "/delete/" + SCM_TOKEN_PATH, body: map[string]interface{}{"versions": []interface{}{"1", "2"}}},
+		{method: http.MethodPut, path: prefix + "/undelete/" + SCM_TOKEN_PATH, body: map[string]interface{}{"versions": []interface{}{2.0}}},
+		{method: http.MethodPut, path: prefix + "/destroy/" + SCM_TOKEN_PATH, body: map[string]interface{}{"versions": []interface{}{1.0}}},
+		{method: http.MethodPatch, path: prefix + "/metadata/" + SCM_TOKEN_PATH, body: map[string]interface{}{
+			"max_versions":         5.0,
+			"cas_required":         true,
+			"delete_version_after": "720h0m0s",
+			"custom_metadata":      map[string]interface{}{"owner": "build-runner"},
+		}},
+		{method: http.MethodDelete, path: prefix + "/metadata/" + SCM_TOKEN_PATH},
+	}, calls)
+}
@@ -0,0 +1,155 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	DEFAULT_WATCH_INTERVAL = 30 * time.Second
+	DEFAULT_WATCH_JITTER   = 0.1
+
+	// minWatchWait is the shortest wait between two polls, whatever the
+	// interval and jitter
+	minWatchWait = time.Millisecond
+)
+
+// WatchOption configures a watch started with Watch.
+type WatchOption func(*watchOptions)
+
+type watchOptions struct {
+	interval time.Duration
+	jitter   float64
+	onError  func(error)
+}
+
+// WithWatchInterval sets how often the secret metadata is polled, defaults
+// to DEFAULT_WATCH_INTERVAL. It must be positive.
+func WithWatchInterval(interval time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.interval = interval
+	}
+}
+
+// WithWatchJitter randomizes every poll interval by up to fraction of it in
+// either direction, so replicas started together do not poll in lockstep.
+// Defaults to DEFAULT_WATCH_JITTER. It must be at least 0 and less than 1.
+func WithWatchJitter(fraction float64) WatchOption {
+	return func(o *watchOptions) {
+		o.jitter = fraction
+	}
+}
+
+// WithWatchErrorHandler sets a function called when polling fails. Polling
+// carries on at the next interval either way.
+func WithWatchErrorHandler(fn func(error)) WatchOption {
+	return func(o *watchOptions) {
+		o.onError = fn
+	}
+}
+
+// watchState identifies what a watched secret looked like at the last poll.
+type watchState struct {
+	version int
+	deleted bool
+	data    VaultSecretMap
+}
+
+// Watch polls the metadata of the secret at secretPath in kvStore and calls fn
+// with the previous and the new data every time a new version is written or
+// the latest version is deleted, in which case new is nil. The current
+// version is read before Watch returns, and polling stops when ctx is done.
+// A secret that does not exist yet is watched too, old is nil once it is
+// created.
+//
+// fn is called from the polling goroutine, one change at a time, so services
+// can rebuild clients such as an S3 session or GCS client from the new
+// credentials there.
+func (vc *VaultClient) Watch(ctx context.Context, kvStore, secretPath string, fn func(old, new VaultSecretMap), opts ...WatchOption) error {
+	o := &watchOptions{interval: DEFAULT_WATCH_INTERVAL, jitter: DEFAULT_WATCH_JITTER}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.interval <= 0 {
+		return fmt.Errorf("watch interval must be positive, got %v", o.interval)
+	}
+	if o.jitter < 0 || o.jitter >= 1 {
+		return fmt.Errorf("watch jitter must be in [0, 1), got %v", o.jitter)
+	}
+
+	state, err := vc.pollSecret(ctx, kvStore, secretPath)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(jitter(o.interval, o.jitter)):
+			}
+
+			next, err := vc.pollSecret(ctx, kvStore, secretPath)
+			if err != nil {
+				if o.onError != nil && ctx.Err() == nil {
+					o.onError(err)
+				}
+				continue
+			}
+			if next.version == state.version && next.deleted == state.deleted {
+				continue
+			}
+
+			// Make sure readers going through the cache see the new version
+			vc.InvalidateSecret(kvStore, secretPath)
+			old := state.data
+			state = next
+			fn(old, next.data)
+		}
+	}()
+	return nil
+}
+
+func (vc *VaultClient) pollSecret(ctx context.Context, kvStore, secretPath string) (*watchState, error) {
+	metadata, err := vc.GetSecretMetadata(ctx, kvStore, secretPath)
+	if errors.Is(err, ErrSecretNotFound) {
+		return &watchState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := &watchState{version: metadata.CurrentVersion}
+	for _, v := range metadata.Versions {
+		if v.Version == metadata.CurrentVersion {
+			state.deleted = !v.DeletionTime.IsZero() || v.Destroyed
+		}
+	}
+	if state.version == 0 || state.deleted {
+		return state, nil
+	}
+
+	if state.data, err = vc.GetSecretVersion(ctx, kvStore, secretPath, state.version); err != nil {
+		if !errors.Is(err, ErrSecretNotFound) {
+			return nil, err
+		}
+		// Deleted between reading the metadata and the data
+		state.deleted = true
+	}
+	return state, nil
+}
+
+func jitter(interval time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return interval
+	}
+	delta := (rand.Float64()*2 - 1) * fraction * float64(interval)
+	if wait := interval + time.Duration(delta); wait > minWatchWait {
+		return wait
+	}
+	return minWatchWait
+}
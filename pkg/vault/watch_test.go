@@ -0,0 +1,76 @@
+package vault
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type secretChange struct {
+	old, new VaultSecretMap
+}
+
+func TestWatch(t *testing.T) {
+	kv, vc := newFakeKV(t)
+	kv.put("kv-v2", "vpn", map[string]interface{}{"VPN_SERVER_PASSWORD": "old"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan secretChange, 4)
+	notify := func(old, new VaultSecretMap) { changes <- secretChange{old, new} }
+	opts := []WatchOption{WithWatchInterval(10 * time.Millisecond), WithWatchJitter(0.5)}
+	assert.NoError(t, vc.Watch(ctx, "kv-v2", "vpn", notify, opts...))
+	assert.NoError(t, vc.Watch(ctx, "kv-v2", "encryption", notify, opts...))
+
+	kv.put("kv-v2", "vpn", map[string]interface{}{"VPN_SERVER_PASSWORD": "new"})
+	select {
+	case change := <-changes:
+		assert.Equal(t, "old", change.old["VPN_SERVER_PASSWORD"])
+		assert.Equal(t, "new", change.new["VPN_SERVER_PASSWORD"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change notified")
+	}
+
+	// Secrets created after the watch started are reported with no old data
+	kv.put("kv-v2", "encryption", map[string]interface{}{"KEY": "k1"})
+	select {
+	case change := <-changes:
+		assert.Nil(t, change.old)
+		assert.Equal(t, "k1", change.new["KEY"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change notified")
+	}
+
+	select {
+	case change := <-changes:
+		t.Fatalf("unexpected change %v", change)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestJitter(t *testing.T) {
+	assert.Equal(t, time.Second, jitter(time.Second, 0))
+	for i := 0; i < 100; i++ {
+		d := jitter(time.Second, 0.1)
+		assert.True(t, d >= 900*time.Millisecond && d <= 1100*time.Millisecond, d)
+	}
+	for i := 0; i < 100; i++ {
+		assert.GreaterOrEqual(t, jitter(time.Nanosecond, 0.99), minWatchWait)
+	}
+}
+
+func TestWatchInvalidOptions(t *testing.T) {
+	_, vc := newFakeKV(t)
+	notify := func(old, new VaultSecretMap) {}
+	for _, opts := range [][]WatchOption{
+		{WithWatchInterval(0)},
+		{WithWatchInterval(-time.Second)},
+		{WithWatchJitter(1)},
+		{WithWatchJitter(-0.1)},
+	} {
+		assert.Error(t, vc.Watch(context.Background(), "kv-v2", "vpn", notify, opts...))
+	}
+}
@@ -0,0 +1,180 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// TOKEN_CREATE_PATH is the creation path of wrapping tokens returned by
+// WrapToken.
+const TOKEN_CREATE_PATH = "auth/token/create"
+
+// ErrWrappingTokenInvalid is matched by errors.Is when a wrapping token does
+// not exist, was already unwrapped, has expired, or was not created at the
+// expected path.
+var ErrWrappingTokenInvalid = errors.New("wrapping token invalid")
+
+// WrapInfo describes a single-use response-wrapping token. The wrapped
+// response can be read once with the token until TTL has passed.
+type WrapInfo struct {
+	Token        string
+	Accessor     string
+	TTL          time.Duration
+	CreationTime time.Time
+	CreationPath string
+}
+
+// WrapSecret wraps the latest version of the secret at secretPath in kvStore
+// in a wrapping token valid for ttl, so it can be handed to a runner that
+// has no access to the store. Unwrap it with UnwrapSecret.
+func (vc *VaultClient) WrapSecret(ctx context.Context, kvStore, secretPath string, ttl time.Duration) (*WrapInfo, error) {
+	ctx, span := startSpan(ctx, "vault.WrapSecret", kvStore, secretPath)
+	defer span.End()
+
+	secret, err := vc.client(ctx, wrapTTL(ttl)).Logical().ReadWithContext(ctx, fmt.Sprintf("%s/data/%s", kvStore, secretPath))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("unable to wrap secret: %v", err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, secretPath)
+	}
+	return newWrapInfo(secret)
+}
+
+// WrapData wraps arbitrary data in a wrapping token valid for ttl.
+func (vc *VaultClient) WrapData(ctx context.Context, data map[string]interface{}, ttl time.Duration) (*WrapInfo, error) {
+	ctx, span := startSpan(ctx, "vault.WrapData", "", "sys/wrapping/wrap")
+	defer span.End()
+
+	secret, err := vc.client(ctx, wrapTTL(ttl)).Logical().WriteWithContext(ctx, "sys/wrapping/wrap", data)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("unable to wrap data: %v", err)
+	}
+	return newWrapInfo(secret)
+}
+
+// WrapToken creates a child token as described by req and wraps it in a
+// wrapping token valid for ttl, so the child token itself is never exposed
+// in transit. Unwrap it with UnwrapToken.
+func (vc *VaultClient) WrapToken(ctx context.Context, req *vault.TokenCreateRequest, ttl time.Duration) (*WrapInfo, error) {
+	ctx, span := startSpan(ctx, "vault.WrapToken", "", TOKEN_CREATE_PATH)
+	defer span.End()
+
+	secret, err := vc.client(ctx, wrapTTL(ttl)).Auth().Token().CreateWithContext(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("unable to wrap token: %v", err)
+	}
+	return newWrapInfo(secret)
+}
+
+// LookupWrappingToken returns the metadata of a wrapping token without
+// unwrapping it. The Token and Accessor fields are not set.
+func (vc *VaultClient) LookupWrappingToken(ctx context.Context, wrappingToken string) (*WrapInfo, error) {
+	ctx, span := startSpan(ctx, "vault.LookupWrappingToken", "", "sys/wrapping/lookup")
+	defer span.End()
+
+	secret, err := vc.client(ctx).Logical().WriteWithContext(ctx, "sys/wrapping/lookup", map[string]interface{}{"token": wrappingToken})
+	if err != nil {
+		span.RecordError(err)
+		var respErr *vault.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == 400 {
+			return nil, fmt.Errorf("%w: %v", ErrWrappingTokenInvalid, err)
+		}
+		return nil, fmt.Errorf("unable to look up wrapping token: %v", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("%w: no wrapping token info returned", ErrWrappingTokenInvalid)
+	}
+
+	info := &WrapInfo{
+		TTL:          time.Duration(intField(secret.Data, "creation_ttl")) * time.Second,
+		CreationPath: fmt.Sprint(secret.Data["creation_path"]),
+	}
+	if created, ok := secret.Data["creation_time"].(string); ok {
+		info.CreationTime, _ = time.Parse(time.RFC3339Nano, created)
+	}
+	return info, nil
+}
+
+// Unwrap returns the response wrapped in wrappingToken, which is consumed in
+// the process. The token is looked up first and rejected with
+// ErrWrappingTokenInvalid unless it was created at expectedCreationPath, so
+// a token swapped in transit for one wrapping something else is never used.
+// The client's own token is not needed.
+func (vc *VaultClient) Unwrap(ctx context.Context, wrappingToken, expectedCreationPath string) (*vault.Secret, error) {
+	info, err := vc.LookupWrappingToken(ctx, wrappingToken)
+	if err != nil {
+		return nil, err
+	}
+	if info.CreationPath != expectedCreationPath {
+		return nil, fmt.Errorf("%w: created at %q, expected %q", ErrWrappingTokenInvalid, info.CreationPath, expectedCreationPath)
+	}
+
+	ctx, span := startSpan(ctx, "vault.Unwrap", "", expectedCreationPath)
+	defer span.End()
+
+	// Authenticate the unwrap with the wrapping token itself
+	client := vc.client(ctx)
+	client.SetToken(wrappingToken)
+	secret, err := client.Logical().UnwrapWithContext(ctx, "")
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("unable to unwrap: %v", err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("%w: nothing wrapped", ErrWrappingTokenInvalid)
+	}
+	return secret, nil
+}
+
+// UnwrapSecret returns the KVv2 secret wrapped by WrapSecret, checking that
+// it is the secret at secretPath in kvStore.
+func (vc *VaultClient) UnwrapSecret(ctx context.Context, wrappingToken, kvStore, secretPath string) (VaultSecretMap, error) {
+	secret, err := vc.Unwrap(ctx, wrappingToken, fmt.Sprintf("%s/data/%s", kvStore, secretPath))
+	if err != nil {
+		return nil, err
+	}
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("value type assertion failed: %T %#v", secret.Data["data"], secret.Data["data"])
+	}
+	return data, nil
+}
+
+// UnwrapToken returns the client token wrapped by WrapToken.
+func (vc *VaultClient) UnwrapToken(ctx context.Context, wrappingToken string) (string, error) {
+	secret, err := vc.Unwrap(ctx, wrappingToken, TOKEN_CREATE_PATH)
+	if err != nil {
+		return "", err
+	}
+	if secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return "", fmt.Errorf("no token found in wrapped response")
+	}
+	return secret.Auth.ClientToken, nil
+}
+
+func wrapTTL(ttl time.Duration) vault.RequestCallback {
+	return func(r *vault.Request) {
+		r.WrapTTL = ttl.String()
+	}
+}
+
+func newWrapInfo(secret *vault.Secret) (*WrapInfo, error) {
+	if secret == nil || secret.WrapInfo == nil {
+		return nil, fmt.Errorf("response was not wrapped")
+	}
+	return &WrapInfo{
+		Token:        secret.WrapInfo.Token,
+		Accessor:     secret.WrapInfo.Accessor,
+		TTL:          time.Duration(secret.WrapInfo.TTL) * time.Second,
+		CreationTime: secret.WrapInfo.CreationTime,
+		CreationPath: secret.WrapInfo.CreationPath,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeWrapping wraps responses of a couple of endpoints and serves the
+// sys/wrapping endpoints for them.
+type fakeWrapping struct {
+	mu      sync.Mutex
+	wrapped map[string]wrappedResponse
+}
+
+type wrappedResponse struct {
+	path     string
+	ttl      string
+	response map[string]interface{}
+}
+
+func (f *fakeWrapping) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	wrap := func(path string, response map[string]interface{}) {
+		token := "hvs.wrap-" + path
+		f.wrapped[token] = wrappedResponse{path: path, ttl: r.Header.Get("X-Vault-Wrap-TTL"), response: response}
+		writeJSON(w, map[string]interface{}{
+			"wrap_info": map[string]interface{}{"token": token, "ttl": 300, "creation_path": path},
+		})
+	}
+
+	switch r.URL.Path {
+	case "/v1/kv-v2/data/build-runner":
+		wrap("kv-v2/data/build-runner", map[string]interface{}{
+			"data": map[string]interface{}{"data": map[string]interface{}{"BR_ACCESS_ENCRYPTION_KEY": "k"}},
+		})
+	case "/v1/auth/token/create":
+		wrap(TOKEN_CREATE_PATH, map[string]interface{}{"auth": map[string]interface{}{"client_token": "hvs.child"}})
+	case "/v1/sys/wrapping/lookup":
+		var body struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		wrapped, ok := f.wrapped[body.Token]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]interface{}{"errors": []string{"wrapping token is not valid or does not exist"}})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"data": map[string]interface{}{
+			"creation_path": wrapped.path, "creation_ttl": 300, "creation_time": time.Now().Format(time.RFC3339Nano),
+		}})
+	case "/v1/sys/wrapping/unwrap":
+		token := r.Header.Get("X-Vault-Token")
+		wrapped, ok := f.wrapped[token]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		delete(f.wrapped, token)
+		writeJSON(w, wrapped.response)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeWrapping(t *testing.T) (*fakeWrapping, *VaultClient) {
+	f := &fakeWrapping{wrapped: map[string]wrappedResponse{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	vc, err := New(WithAddress(server.URL), WithToken("token"), WithRetry(0, 0, 0))
+	assert.NoError(t, err)
+	return f, vc
+}
+
+func TestWrapSecret(t *testing.T) {
+	ctx := context.Background()
+	f, vc := newFakeWrapping(t)
+
+	info, err := vc.WrapSecret(ctx, "kv-v2", "build-runner", 5*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "kv-v2/data/build-runner", info.CreationPath)
+	assert.Equal(t, 5*time.Minute, info.TTL)
+	assert.Equal(t, "5m0s", f.wrapped[info.Token].ttl)
+
+	lookup, err := vc.LookupWrappingToken(ctx, info.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, "kv-v2/data/build-runner", lookup.CreationPath)
+
+	// A token wrapping something else is rejected without being consumed
+	_, err = vc.UnwrapSecret(ctx, info.Token, "kv-v2", "other")
+	assert.True(t, errors.Is(err, ErrWrappingTokenInvalid))
+
+	secret, err := vc.UnwrapSecret(ctx, info.Token, "kv-v2", "build-runner")
+	assert.NoError(t, err)
+	assert.Equal(t, "k", secret["BR_ACCESS_ENCRYPTION_KEY"])
+
+	// Wrapping tokens are single use
+	_, err = vc.UnwrapSecret(ctx, info.Token, "kv-v2", "build-runner")
+	assert.True(t, errors.Is(err, ErrWrappingTokenInvalid))
+}
+
+func TestWrapToken(t *testing.T) {
+	ctx := context.Background()
+	_, vc := newFakeWrapping(t)
+
+	info, err := vc.WrapToken(ctx, &vault.TokenCreateRequest{Policies: []string{"build-runner"}}, time.Minute)
+	assert.NoError(t, err)
+
+	token, err := vc.UnwrapToken(ctx, info.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, "hvs.child", token)
+	assert.Equal(t, "token", vc.Cli.Token())
+}
@@ -0,0 +1,94 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// ErrCheckAndSetMismatch is matched by errors.Is when a check-and-set write
+// is rejected because the current version of the secret differs from the
+// expected one.
+var ErrCheckAndSetMismatch = errors.New("check-and-set version mismatch")
+
+// WriteOption configures a secret write.
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	cas *int
+}
+
+// WithCheckAndSet makes the write fail with ErrCheckAndSetMismatch unless the
+// current version of the secret is version. A version of 0 only allows the
+// write when the secret does not exist yet.
+func WithCheckAndSet(version int) WriteOption {
+	return func(o *writeOptions) {
+		o.cas = &version
+	}
+}
+
+func (o *writeOptions) kvOptions() []vault.KVOption {
+	var kvOpts []vault.KVOption
+	if o.cas != nil {
+		kvOpts = append(kvOpts, vault.WithCheckAndSet(*o.cas))
+	}
+	return kvOpts
+}
+
+// PutSecretMap replaces the secret at secretPath in kvStore with data and
+// returns the version that was written. Keys not present in data are removed
+// from the new version, use PatchSecret to keep them.
+func (vc *VaultClient) PutSecretMap(ctx context.Context, kvStore, secretPath string, data VaultSecretMap, opts ...WriteOption) (int, error) {
+	ctx, span := startSpan(ctx, "vault.PutSecretMap", kvStore, secretPath)
+	defer span.End()
+
+	o := &writeOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	secret, err := vc.client(ctx).KVv2(kvStore).Put(ctx, secretPath, data, o.kvOptions()...)
+	vc.InvalidateSecret(kvStore, secretPath)
+	if err != nil {
+		span.RecordError(err)
+		return 0, writeError(err)
+	}
+	return secret.VersionMetadata.Version, nil
+}
+
+// PatchSecret merges data into the latest version of the secret at secretPath
+// in kvStore, keeping every key not present in data, and returns the version
+// that was written. The secret must already exist.
+func (vc *VaultClient) PatchSecret(ctx context.Context, kvStore, secretPath string, data VaultSecretMap, opts ...WriteOption) (int, error) {
+	ctx, span := startSpan(ctx, "vault.PatchSecret", kvStore, secretPath)
+	defer span.End()
+
+	o := &writeOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	secret, err := vc.client(ctx).KVv2(kvStore).Patch(ctx, secretPath, data, o.kvOptions()...)
+	vc.InvalidateSecret(kvStore, secretPath)
+	if err != nil {
+		span.RecordError(err)
+		return 0, writeError(err)
+	}
+	return secret.VersionMetadata.Version, nil
+}
+
+func writeError(err error) error {
+	var respErr *vault.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusBadRequest {
+		for _, msg := range respErr.Errors {
+			if strings.Contains(msg, "check-and-set") {
+				return fmt.Errorf("unable to write secret: %w: %v", ErrCheckAndSetMismatch, err)
+			}
+		}
+	}
+	return fmt.Errorf("unable to write secret: %v", err)
+}
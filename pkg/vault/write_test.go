@@ -0,0 +1,33 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutAndPatchSecret(t *testing.T) {
+	_, vc := newFakeKV(t)
+	ctx := context.Background()
+
+	version, err := vc.PutSecretMap(ctx, USER_DATA_STORE, SCM_TOKEN_PATH, VaultSecretMap{SCM_ENCRYPTION_KEY: "k1", "OTHER": "o1"}, WithCheckAndSet(0))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	version, err = vc.PatchSecret(ctx, USER_DATA_STORE, SCM_TOKEN_PATH, VaultSecretMap{SCM_ENCRYPTION_KEY: "k2"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	secret, err := vc.GetSecretMapByStoreCtx(ctx, SCM_TOKEN_PATH, USER_DATA_STORE)
+	assert.NoError(t, err)
+	assert.Equal(t, VaultSecretMap{SCM_ENCRYPTION_KEY: "k2", "OTHER": "o1"}, secret)
+
+	_, err = vc.PutSecretMap(ctx, USER_DATA_STORE, SCM_TOKEN_PATH, VaultSecretMap{SCM_ENCRYPTION_KEY: "k3"}, WithCheckAndSet(1))
+	assert.True(t, errors.Is(err, ErrCheckAndSetMismatch))
+
+	version, err = vc.PutSecretMap(ctx, USER_DATA_STORE, SCM_TOKEN_PATH, VaultSecretMap{SCM_ENCRYPTION_KEY: "k3"}, WithCheckAndSet(2))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+}